@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"sync"
+
+	"github.com/Kostushka/tcp_server/internal/rotate"
+)
+
+// logFiles - открытые файлы логов виртуальных хостов; файл с одним путем открывается один раз
+// и переиспользуется при перезагрузке конфигурации
+type logFiles struct {
+	cfg rotate.Config
+
+	mu    sync.Mutex
+	files map[string]*rotate.File
+}
+
+func newLogFiles(cfg rotate.Config) *logFiles {
+	return &logFiles{
+		cfg:   cfg,
+		files: make(map[string]*rotate.File),
+	}
+}
+
+// open - открыть файл лога или вернуть уже открытый
+func (l *logFiles) open(path string) (io.Writer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.files[path]; ok {
+		return f, nil
+	}
+
+	f, err := rotate.Open(path, l.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	l.files[path] = f
+
+	return f, nil
+}
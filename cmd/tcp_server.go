@@ -2,16 +2,44 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"html/template"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
+	"github.com/Kostushka/tcp_server/internal/accesslog"
+	"github.com/Kostushka/tcp_server/internal/acl"
+	"github.com/Kostushka/tcp_server/internal/admin"
+	"github.com/Kostushka/tcp_server/internal/auth"
 	"github.com/Kostushka/tcp_server/internal/config"
 	"github.com/Kostushka/tcp_server/internal/connection"
+	"github.com/Kostushka/tcp_server/internal/dir"
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+	"github.com/Kostushka/tcp_server/internal/filecache"
+	"github.com/Kostushka/tcp_server/internal/location"
 	mlog "github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/markdown"
+	"github.com/Kostushka/tcp_server/internal/metrics"
+	"github.com/Kostushka/tcp_server/internal/proxyproto"
+	"github.com/Kostushka/tcp_server/internal/ratelimit"
+	"github.com/Kostushka/tcp_server/internal/realip"
+	"github.com/Kostushka/tcp_server/internal/rewrite"
+	"github.com/Kostushka/tcp_server/internal/serve"
+	"github.com/Kostushka/tcp_server/internal/ssi"
+	"github.com/Kostushka/tcp_server/internal/throttle"
+	"github.com/Kostushka/tcp_server/internal/vhost"
 )
 
+// сколько ждать завершения открытых соединений при остановке сервера
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// получить данные для конфигурации сервера
 	configData, err := config.NewConfigData()
@@ -20,20 +48,136 @@ func main() {
 	}
 
 	// создать логеры
-	err = mlog.New(configData.Log())
+	err = mlog.New(mlog.Config{
+		File:   configData.Log(),
+		Level:  configData.LogLevel(),
+		Format: configData.LogFormat(),
+		Rotate: configData.LogRotate(),
+	})
 	if err != nil {
 		log.Fatalf("сервер не может быть запущен: %v", err)
 	}
 
 	// парсим шаблон для отображения имен файлов
-	templ, err := os.ReadFile(configData.FileTemplate())
+	t, err := dir.LoadTemplate(configData.FileTemplate())
 	if err != nil {
 		log.Fatalf("сервер не может быть запущен: %v", err)
 	}
-	// используем шаблон для отображения имен файлов
-	t, err := template.New("index").Parse(string(templ))
-	if err != nil {
+
+	// общие для всех соединений данные сервера
+	settings := &connection.Settings{
+		RootPath: configData.RootPath(),
+		PerPage:  configData.PerPage(),
+
+		ArchiveMaxSize: configData.ArchiveMaxSize(),
+	}
+	settings.SetTemplate(t)
+
+	// шаблон страниц Markdown нужен, только если их отрисовка включена для сервера или location
+	if mt, err := markdown.LoadTemplate(configData.MarkdownTemplate()); err == nil {
+		settings.Markdown = markdown.New(mt)
+		settings.RenderMarkdown = configData.Markdown()
+	} else if configData.Markdown() {
 		log.Fatalf("сервер не может быть запущен: %v", err)
+	} else {
+		mlog.Warnf("%v: отрисовка Markdown недоступна", err)
+	}
+
+	// директивы SSI в файлах с указанными расширениями
+	if len(configData.SSI()) > 0 {
+		settings.SSI = ssi.New(ssi.Config{Extensions: configData.SSI()})
+	}
+
+	// кеш содержимого часто запрашиваемых файлов
+	if configData.CacheSize() > 0 {
+		settings.FileCache = filecache.New(configData.CacheSize(), configData.CacheMaxEntry(), configData.CacheTTL())
+	}
+
+	// кеш содержимого каталогов
+	if configData.DirCache() > 0 {
+		settings.DirCache = dir.NewCache(configData.DirCache())
+	}
+
+	// правила аутентификации
+	if len(configData.AuthRules()) > 0 {
+		settings.Auth, err = auth.New(configData.AuthRules())
+		if err != nil {
+			log.Fatalf("сервер не может быть запущен: %v", err)
+		}
+	}
+
+	// правила доступа по IP-адресам клиентов
+	if len(configData.AccessLists()) > 0 {
+		settings.ACL = acl.New(configData.AccessLists())
+	}
+
+	// доверенные прокси, от которых принимаются заголовки с адресом клиента
+	if len(configData.TrustedProxies()) > 0 {
+		settings.RealIP = realip.New(configData.TrustedProxies())
+	}
+
+	// ограничения частоты запросов и количества соединений клиентов
+	if rl := configData.RateLimit(); rl.Rate > 0 || rl.MaxConnsPerIP > 0 || rl.MaxConnsPerSubnet > 0 {
+		settings.Limiter = ratelimit.New(rl)
+	}
+
+	// ограничения скорости отдачи данных клиентам
+	if bw := configData.Bandwidth(); bw.PerConn > 0 || bw.PerIP > 0 || bw.Global > 0 {
+		settings.Throttle = throttle.New(bw)
+	}
+
+	files := newLogFiles(configData.LogRotate())
+
+	// журнал запросов
+	if configData.AccessLog() != "" {
+		f, err := files.open(configData.AccessLog())
+		if err != nil {
+			log.Fatalf("сервер не может быть запущен: %v", err)
+		}
+
+		settings.AccessLog, err = accesslog.New(f, configData.AccessLogFormat())
+		if err != nil {
+			log.Fatalf("сервер не может быть запущен: %v", err)
+		}
+	}
+
+	// location и виртуальные хосты из файла конфигурации сайта; обработчики static используют кеши сервера
+	if err = applySite(configData.Site(), configData, settings, files); err != nil {
+		log.Fatalf("сервер не может быть запущен: %v", err)
+	}
+
+	// служебный сервер с метриками и страницей состояния
+	if configData.AdminAddr() != "" {
+		settings.Metrics = metrics.New()
+		settings.Registry = connection.NewRegistry()
+
+		if fc := settings.FileCache; fc != nil {
+			settings.Metrics.CounterFunc("tcp_server_file_cache_hits_total", "File cache hits.", func() float64 {
+				hits, _ := fc.Stats()
+
+				return float64(hits)
+			})
+			settings.Metrics.CounterFunc("tcp_server_file_cache_misses_total", "File cache misses.", func() float64 {
+				_, misses := fc.Stats()
+
+				return float64(misses)
+			})
+		}
+
+		adminServer := admin.New(configData.AdminAddr())
+		adminServer.Handle("/metrics", settings.Metrics.Handler())
+		status, err := admin.NewStatus(settings.Metrics, settings.Registry, configData, func() (any, error) {
+			return reload(configData, settings, files)
+		}, configData.AdminToken())
+		if err != nil {
+			log.Fatalf("сервер не может быть запущен: %v", err)
+		}
+
+		status.Register(adminServer)
+
+		if err = adminServer.Start(); err != nil {
+			log.Fatalf("сервер не может быть запущен: %v", err)
+		}
 	}
 
 	// объявляем структуру с данными будущего сервера
@@ -43,25 +187,155 @@ func main() {
 	}
 
 	// получаем структуру с методами для работы с соединениями
-	l, err := net.ListenTCP("tcp", &laddr)
+	tcpListener, err := net.ListenTCP("tcp", &laddr)
 	if err != nil {
 		log.Fatalf("сервер не может быть запущен: %v", err)
 	}
-	defer connection.Close(l, "")
 
-	mlog.Infof("Запуск сервера с адресом %v на порту %d", laddr.IP, laddr.Port)
+	var l net.Listener = tcpListener
+
+	// адрес клиента передается балансировщиком в заголовке PROXY protocol
+	if configData.ProxyProtocol() {
+		l = proxyproto.NewListener(l, configData.ProxyProtocolFrom(), configData.ProxyProtocolTimeout())
+	}
+
+	srv := serve.New(settings)
+
+	// по сигналу перестаем принимать соединения и даем открытым завершиться
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	for {
-		mlog.Infof("tcp сокет слушает соединения")
-		// слушаем сокетные соединения (запросы)
-		conn, err := l.AcceptTCP()
+	go func() {
+		<-ctx.Done()
+
+		mlog.Infof("сервер останавливается")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			mlog.Errorf("соединения закрыты принудительно: %v", err)
+		}
+	}()
+
+	if err = srv.Serve(l); err != nil && !errors.Is(err, serve.ErrServerClosed) {
+		log.Fatalf("сервер остановлен: %v", err)
+	}
+}
+
+// флаги, файлы которых перечитываются при перезагрузке; остальные флаги командной строки
+// (аутентификация, ACL, доверенные прокси, ограничения частоты и скорости, журналы, кеши)
+// действуют до перезапуска сервера
+var reloadableFlags = []string{"templ", "md-templ", "conf"}
+
+// reloadResult - что сделано при перезагрузке конфигурации
+type reloadResult struct {
+	// Reloaded - перечитанные файлы и сброшенные кеши
+	Reloaded []string `json:"reloaded"`
+	// RestartRequired - флаги командной строки, изменение которых вступает в силу только после перезапуска
+	RestartRequired []string `json:"restart_required"`
+}
+
+// перезагружаем конфигурацию: перечитываем шаблоны и файл конфигурации сайта (location, rewrites,
+// error_pages, hosts), сбрасываем кеши; при ошибке продолжаем работать со старой конфигурацией,
+// уже открытые соединения дорабатывают со старыми данными
+func reload(configData *config.Data, settings *connection.Settings, files *logFiles) (*reloadResult, error) {
+	res := &reloadResult{}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if !slices.Contains(reloadableFlags, f.Name) {
+			res.RestartRequired = append(res.RestartRequired, f.Name)
+		}
+	})
+
+	t, err := dir.LoadTemplate(configData.FileTemplate())
+	if err != nil {
+		return nil, err
+	}
+
+	res.Reloaded = append(res.Reloaded, "templ "+configData.FileTemplate())
+
+	var mt *template.Template
+
+	if settings.Markdown != nil {
+		mt, err = markdown.LoadTemplate(configData.MarkdownTemplate())
 		if err != nil {
-			mlog.Errorf(err)
+			return nil, err
 		}
 
-		mlog.Infof("запрос на соединение от клиента принят")
+		res.Reloaded = append(res.Reloaded, "md-templ "+configData.MarkdownTemplate())
+	}
+
+	site, err := config.LoadSite(configData.SiteFile())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applySite(site, configData, settings, files); err != nil {
+		return nil, err
+	}
+
+	if configData.SiteFile() != "" {
+		res.Reloaded = append(res.Reloaded, "conf "+configData.SiteFile())
+	}
+
+	settings.SetTemplate(t)
+
+	if settings.Markdown != nil {
+		settings.Markdown.SetTemplate(mt)
+	}
+
+	if settings.FileCache != nil {
+		settings.FileCache.Purge()
+		res.Reloaded = append(res.Reloaded, "file cache purged")
+	}
 
-		// создаем структуру с данными клиентского соединения и обрабатываем каждое клиентское соединение в отдельной горутине
-		go connection.New(conn, configData.RootPath(), t).ProcessingConn()
+	if settings.DirCache != nil {
+		settings.DirCache.Purge()
+		res.Reloaded = append(res.Reloaded, "dir cache purged")
 	}
+
+	return res, nil
+}
+
+// создаем location и виртуальные хосты сайта и подменяем ими текущие
+func applySite(site *config.Site, configData *config.Data, settings *connection.Settings, files *logFiles) error {
+	pages, err := errorpage.New(site.ErrorPages, nil)
+	if err != nil {
+		return err
+	}
+
+	router, err := location.New(site.Locations, settings.StaticConfig(), pages)
+	if err != nil {
+		return err
+	}
+
+	rewrites, err := rewrite.New(site.Rewrites)
+	if err != nil {
+		return err
+	}
+
+	var hosts *vhost.Table
+
+	if len(site.Hosts) > 0 {
+		hosts, err = vhost.New(site.Hosts, site.UnknownHost, vhost.Options{
+			Static:          settings.StaticConfig(),
+			Locations:       site.Locations,
+			Rewrites:        site.Rewrites,
+			ErrorPages:      pages,
+			OpenFile:        files.open,
+			LogFormat:       configData.LogFormat(),
+			AccessLogFormat: configData.AccessLogFormat(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	settings.SetRouter(router)
+	settings.SetRewrites(rewrites)
+	settings.SetErrorPages(pages)
+	settings.SetHosts(hosts)
+
+	return nil
 }
@@ -1,3 +1,5 @@
 module github.com/Kostushka/tcp_server
 
 go 1.22.4
+
+require golang.org/x/crypto v0.31.0
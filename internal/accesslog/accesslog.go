@@ -0,0 +1,281 @@
+// Package accesslog - пакет для записи журнала запросов в формате Common/Combined Log Format
+// или в формате, заданном строкой с %-директивами
+package accesslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FormatCommon - Apache Common Log Format
+	FormatCommon = `%h %l %u %t "%r" %>s %b`
+	// FormatCombined - Apache Combined Log Format
+	FormatCombined = FormatCommon + ` "%{Referer}i" "%{User-Agent}i"`
+)
+
+// ErrInvalidFormat - некорректная строка формата журнала
+var ErrInvalidFormat = errors.New("некорректный формат журнала запросов")
+
+// формат времени директивы %t
+const timeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Entry - данные завершенного запроса
+type Entry struct {
+	Client   string
+	User     string
+	Start    time.Time
+	Duration time.Duration
+	Method   string
+	// Target - цель запроса из строки запроса без декодирования, как ее прислал клиент
+	Target    string
+	Path      string
+	Query     string
+	Protocol  string
+	Status    int
+	Bytes     int64
+	RequestID string
+	// Header - возвращает значение заголовка запроса, nil - запрос не был распарсен
+	Header func(name string) string
+}
+
+// requestLine - строка запроса в том виде, в котором она пишется в журнал
+func (e *Entry) requestLine() string {
+	if e.Method == "" {
+		return "-"
+	}
+
+	target := e.Target
+	if target == "" {
+		target = e.Path
+		if e.Query != "" {
+			target += "?" + e.Query
+		}
+	}
+
+	return e.Method + " " + target + " " + e.Protocol
+}
+
+// urlPath - путь запроса без декодирования
+func (e *Entry) urlPath() string {
+	if e.Target == "" {
+		return e.Path
+	}
+
+	p, _, _ := strings.Cut(e.Target, "?")
+
+	return p
+}
+
+func (e *Entry) header(name string) string {
+	if e.Header == nil {
+		return ""
+	}
+
+	return e.Header(name)
+}
+
+// часть строки журнала: текст или значение директивы
+type segment func(buf *bytes.Buffer, e *Entry)
+
+// Logger - пишет журнал запросов в заданном формате
+type Logger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	segments []segment
+}
+
+// New - создать журнал запросов; format - common, combined или строка с %-директивами
+func New(w io.Writer, format string) (*Logger, error) {
+	switch format {
+	case "", "combined":
+		format = FormatCombined
+	case "common":
+		format = FormatCommon
+	}
+
+	segments, err := parse(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logger{w: w, segments: segments}, nil
+}
+
+// Log - записать в журнал данные запроса
+func (l *Logger) Log(e *Entry) error {
+	var buf bytes.Buffer
+
+	for _, s := range l.segments {
+		s(&buf, e)
+	}
+
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.w.Write(buf.Bytes())
+
+	return err
+}
+
+// разбираем строку формата на части
+func parse(format string) ([]segment, error) {
+	var segments []segment
+
+	for len(format) > 0 {
+		i := strings.IndexByte(format, '%')
+		if i == -1 {
+			segments = append(segments, literal(format))
+
+			break
+		}
+
+		if i > 0 {
+			segments = append(segments, literal(format[:i]))
+		}
+
+		format = format[i+1:]
+		if format == "" {
+			return nil, fmt.Errorf("%w: строка заканчивается на %%", ErrInvalidFormat)
+		}
+
+		// %{Name}i - значение заголовка запроса
+		var arg string
+
+		if format[0] == '{' {
+			end := strings.IndexByte(format, '}')
+			if end == -1 || end == len(format)-1 {
+				return nil, fmt.Errorf("%w: незакрытая скобка", ErrInvalidFormat)
+			}
+
+			arg, format = format[1:end], format[end+1:]
+		}
+
+		// %>s - финальный статус, для этого сервера совпадает с %s
+		format = strings.TrimPrefix(format, ">")
+		if format == "" {
+			return nil, fmt.Errorf("%w: строка заканчивается на %%>", ErrInvalidFormat)
+		}
+
+		s, err := directive(format[0], arg)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, s)
+		format = format[1:]
+	}
+
+	return segments, nil
+}
+
+func literal(s string) segment {
+	return func(buf *bytes.Buffer, _ *Entry) {
+		buf.WriteString(s)
+	}
+}
+
+// значение директивы, пустое значение пишется как "-"; значения от клиента экранируются
+func value(f func(e *Entry) string) segment {
+	return func(buf *bytes.Buffer, e *Entry) {
+		v := f(e)
+		if v == "" {
+			v = "-"
+		}
+
+		escape(buf, v)
+	}
+}
+
+// записать значение, экранируя '"', '\\' и управляющие символы, как Apache: иначе перевод строки
+// или кавычка в пути запроса или заголовке позволят подделать или испортить строку журнала
+func escape(buf *bytes.Buffer, v string) {
+	const hex = "0123456789abcdef"
+
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			buf.WriteString(`\x`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// функция, вычисляющая значение директивы
+func directive(d byte, arg string) (segment, error) {
+	switch d {
+	case '%':
+		return literal("%"), nil
+	case 'h':
+		return value(func(e *Entry) string { return e.Client }), nil
+	case 'l':
+		return literal("-"), nil
+	case 'u':
+		return value(func(e *Entry) string { return e.User }), nil
+	case 't':
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString("[" + e.Start.Format(timeLayout) + "]")
+		}, nil
+	case 'r':
+		return value((*Entry).requestLine), nil
+	case 'm':
+		return value(func(e *Entry) string { return e.Method }), nil
+	case 'U':
+		return value((*Entry).urlPath), nil
+	case 'q':
+		return func(buf *bytes.Buffer, e *Entry) {
+			if e.Query != "" {
+				escape(buf, "?"+e.Query)
+			}
+		}, nil
+	case 'H':
+		return value(func(e *Entry) string { return e.Protocol }), nil
+	case 's':
+		return value(func(e *Entry) string {
+			// ответ не был отправлен
+			if e.Status == 0 {
+				return ""
+			}
+
+			return strconv.Itoa(e.Status)
+		}), nil
+	case 'b':
+		return value(func(e *Entry) string {
+			if e.Bytes == 0 {
+				return ""
+			}
+
+			return strconv.FormatInt(e.Bytes, 10)
+		}), nil
+	case 'B':
+		return value(func(e *Entry) string { return strconv.FormatInt(e.Bytes, 10) }), nil
+	case 'D':
+		return value(func(e *Entry) string { return strconv.FormatInt(e.Duration.Microseconds(), 10) }), nil
+	case 'T':
+		return value(func(e *Entry) string { return strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64) }), nil
+	case 'L':
+		return value(func(e *Entry) string { return e.RequestID }), nil
+	case 'i':
+		if arg == "" {
+			return nil, fmt.Errorf("%w: для %%i не указан заголовок", ErrInvalidFormat)
+		}
+
+		return value(func(e *Entry) string { return e.header(arg) }), nil
+	default:
+		return nil, fmt.Errorf("%w: неизвестная директива %%%c", ErrInvalidFormat, d)
+	}
+}
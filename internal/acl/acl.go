@@ -0,0 +1,174 @@
+// Package acl - пакет со списками правил доступа allow/deny по IP-адресам и подсетям клиентов
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidRule - некорректное правило доступа
+var ErrInvalidRule = errors.New("некорректное правило доступа")
+
+// Rule - правило доступа: разрешить или запретить доступ адресам подсети
+type Rule struct {
+	Allow bool
+	// Net - подсеть, nil - все адреса
+	Net *net.IPNet
+}
+
+// String - возвращает правило в том виде, в котором оно задается в конфигурации
+func (r Rule) String() string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+
+	if r.Net == nil {
+		return action + " all"
+	}
+
+	return action + " " + r.Net.String()
+}
+
+// List - упорядоченный список правил для запросов, путь которых начинается с префикса
+type List struct {
+	Prefix string
+	Rules  []Rule
+}
+
+// ParseList - парсим список правил вида "[/prefix:]allow 10.0.0.0/8,allow fd00::/8,deny all";
+// без префикса список применяется ко всем путям
+func ParseList(s string) (List, error) {
+	list := List{Prefix: "/"}
+
+	if strings.HasPrefix(s, "/") {
+		prefix, rules, ok := strings.Cut(s, ":")
+		if !ok {
+			return list, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+		}
+
+		list.Prefix = "/" + strings.Trim(prefix, "/")
+		s = rules
+	}
+
+	for _, v := range strings.Split(s, ",") {
+		rule, err := parseRule(strings.TrimSpace(v))
+		if err != nil {
+			return list, err
+		}
+
+		list.Rules = append(list.Rules, rule)
+	}
+
+	return list, nil
+}
+
+// парсим правило вида "allow 10.0.0.0/8", "deny 192.168.1.1" или "deny all"
+func parseRule(s string) (Rule, error) {
+	action, addr, ok := strings.Cut(s, " ")
+	if !ok {
+		return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+	}
+
+	var rule Rule
+
+	switch action {
+	case "allow":
+		rule.Allow = true
+	case "deny":
+	default:
+		return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+	}
+
+	addr = strings.TrimSpace(addr)
+	if addr == "all" {
+		return rule, nil
+	}
+
+	// отдельный адрес - подсеть из одного адреса
+	if !strings.Contains(addr, "/") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		rule.Net = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+
+		return rule, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(addr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w: %q: %w", ErrInvalidRule, s, err)
+	}
+
+	rule.Net = ipNet
+
+	return rule, nil
+}
+
+// ACL - списки правил доступа по префиксам пути
+type ACL struct {
+	// списки отсортированы по убыванию длины префикса
+	lists []List
+}
+
+// New - создать списки правил доступа; списки с одинаковым префиксом объединяются по порядку
+func New(lists []List) *ACL {
+	byPrefix := make(map[string]int)
+	a := &ACL{}
+
+	for _, v := range lists {
+		if i, ok := byPrefix[v.Prefix]; ok {
+			a.lists[i].Rules = append(a.lists[i].Rules, v.Rules...)
+
+			continue
+		}
+
+		byPrefix[v.Prefix] = len(a.lists)
+		a.lists = append(a.lists, v)
+	}
+
+	// списки проверяются от самого длинного префикса, под который попадает путь, к более коротким
+	sort.SliceStable(a.lists, func(i, j int) bool {
+		return len(a.lists[i].Prefix) > len(a.lists[j].Prefix)
+	})
+
+	return a
+}
+
+// Allowed - проверяет, разрешен ли доступ к пути с адреса ip; правила списка проверяются по порядку
+// до первого совпадения, если в списке ни одно не совпало - проверяется список с более коротким префиксом,
+// вплоть до списка для всех путей; если не совпало ни одно правило - доступ разрешен.
+// Также возвращает описание решения для лога
+func (a *ACL) Allowed(path string, ip net.IP) (bool, string) {
+	matched := false
+
+	for _, list := range a.lists {
+		if list.Prefix != "/" && path != list.Prefix && !strings.HasPrefix(path, list.Prefix+"/") {
+			continue
+		}
+
+		matched = true
+
+		for _, r := range list.Rules {
+			if r.Net == nil || (ip != nil && r.Net.Contains(ip)) {
+				return r.Allow, fmt.Sprintf("правило %q для префикса %q", r, list.Prefix)
+			}
+		}
+	}
+
+	if matched {
+		return true, "ни одно правило для пути не подошло"
+	}
+
+	return true, "правила доступа не заданы"
+}
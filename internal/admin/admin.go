@@ -0,0 +1,103 @@
+// Package admin - пакет с отдельным служебным HTTP-сервером для метрик и управления
+package admin
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+)
+
+// время ожидания заголовков запроса к служебному серверу
+const readHeaderTimeout = 10 * time.Second
+
+// ErrInvalidHost - запрос к служебному серверу по имени хоста, которое он не обслуживает
+var ErrInvalidHost = errors.New("неизвестный хост служебного сервера")
+
+// Server - служебный HTTP-сервер
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+}
+
+// New - создать служебный сервер; если в адресе не указан хост, сервер слушает только localhost
+func New(addr string) *Server {
+	return &Server{
+		addr: normalizeAddr(addr),
+		mux:  http.NewServeMux(),
+	}
+}
+
+// Addr - возвращает адрес, на котором слушает служебный сервер
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Handle - зарегистрировать обработчик
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Start - начать принимать соединения в отдельной горутине
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           s.checkHost(s.mux),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("служебный сервер остановлен: %v", err)
+		}
+	}()
+
+	log.Infof("служебный сервер слушает %s", l.Addr())
+
+	return nil
+}
+
+// пропускаем только запросы к localhost, IP-адресу или хосту из адреса сервера: страница чужого сайта,
+// имя которого указывает на 127.0.0.1 (DNS rebinding), передает в Host свое имя и получает отказ
+func (s *Server) checkHost(next http.Handler) http.Handler {
+	listenHost, _, _ := net.SplitHostPort(s.addr) //nolint:errcheck
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+		if !strings.EqualFold(host, "localhost") && net.ParseIP(host) == nil && !strings.EqualFold(host, listenHost) {
+			log.Errorf("служебный сервер: %v: %q", ErrInvalidHost, r.Host)
+			writeError(w, http.StatusForbidden, ErrInvalidHost)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// адрес без хоста ("9090" или ":9090") привязываем к localhost
+func normalizeAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort("127.0.0.1", addr)
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
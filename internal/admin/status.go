@@ -0,0 +1,263 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/connection"
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/metrics"
+)
+
+// TokenHeader - заголовок с токеном, без которого не выполняются запросы, изменяющие состояние сервера
+const TokenHeader = "X-Admin-Token"
+
+var (
+	// ErrCrossOrigin - изменяющий запрос отправлен со страницы другого сайта
+	ErrCrossOrigin = errors.New("запрос с другого сайта отклонен")
+	// ErrInvalidToken - не указан или неверен токен служебного сервера
+	ErrInvalidToken = errors.New("неверный токен служебного сервера")
+)
+
+// Status - страница состояния сервера и API управления
+type Status struct {
+	start    time.Time
+	metrics  *metrics.Metrics
+	registry *connection.Registry
+	config   json.Marshaler
+	reload   func() (any, error)
+	token    string
+}
+
+// NewStatus - создать страницу состояния; reload - перезагрузка конфигурации, возвращающая описание
+// перечитанного для ответа API, nil - перезагрузка недоступна;
+// token - токен для запросов, изменяющих состояние, пусто - создается случайный токен,
+// который пишется в лог при запуске; на странице состояния токен вводит оператор
+func NewStatus(m *metrics.Metrics, r *connection.Registry, config json.Marshaler, reload func() (any, error),
+	token string,
+) (*Status, error) {
+	s := &Status{
+		start:    time.Now(),
+		metrics:  m,
+		registry: r,
+		config:   config,
+		reload:   reload,
+		token:    token,
+	}
+
+	if s.token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		s.token = hex.EncodeToString(b)
+		log.Infof("токен служебного сервера: %s; задайте -admin-token, чтобы он не менялся при перезапуске", s.token)
+	}
+
+	return s, nil
+}
+
+// Register - зарегистрировать обработчики страницы состояния на служебном сервере
+func (s *Status) Register(srv *Server) {
+	srv.Handle("GET /status", http.HandlerFunc(s.page))
+	srv.Handle("GET /api/status", http.HandlerFunc(s.status))
+	srv.Handle("POST /api/reload", s.protect(s.reloadConfig))
+	srv.Handle("POST /api/connections/{id}/close", s.protect(s.closeConn))
+}
+
+// пропустить изменяющий запрос, только если он пришел не со страницы другого сайта и с верным токеном:
+// сторонняя страница не может ни прочитать токен, ни отправить заголовок TokenHeader без preflight
+func (s *Status) protect(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				log.Errorf("служебный сервер: %v: Origin %q", ErrCrossOrigin, origin)
+				writeError(w, http.StatusForbidden, ErrCrossOrigin)
+
+				return
+			}
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(s.token)) != 1 {
+			log.Errorf("служебный сервер: %v", ErrInvalidToken)
+			writeError(w, http.StatusUnauthorized, ErrInvalidToken)
+
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// данные страницы состояния
+type statusData struct {
+	Started     time.Time         `json:"started"`
+	Uptime      string            `json:"uptime"`
+	Totals      totals            `json:"totals"`
+	Config      json.Marshaler    `json:"config"`
+	Connections []connection.Info `json:"connections"`
+}
+
+// счетчики с момента запуска сервера
+type totals struct {
+	Connections uint64 `json:"connections"`
+	Active      int64  `json:"active_connections"`
+	Requests    uint64 `json:"requests"`
+	BytesSent   uint64 `json:"bytes_sent"`
+}
+
+func (s *Status) collect() statusData {
+	return statusData{
+		Started: s.start,
+		Uptime:  time.Since(s.start).Round(time.Second).String(),
+		Totals: totals{
+			Connections: s.metrics.Connections(),
+			Active:      s.metrics.ActiveConns(),
+			Requests:    s.metrics.Requests(),
+			BytesSent:   s.metrics.BytesSent(),
+		},
+		Config:      s.config,
+		Connections: s.registry.List(),
+	}
+}
+
+// GET /api/status - состояние сервера в JSON
+func (s *Status) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.collect())
+}
+
+// GET /status - состояние сервера в HTML
+func (s *Status) page(w http.ResponseWriter, _ *http.Request) {
+	data := s.collect()
+
+	cfg, err := json.MarshalIndent(data.Config, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = statusPage.Execute(w, struct {
+		statusData
+		ConfigJSON string
+	}{data, string(cfg)})
+	if err != nil {
+		log.Errorf("не удалось отрисовать страницу состояния: %v", err)
+	}
+}
+
+// POST /api/reload - перезагрузить конфигурацию; в ответе - что перечитано и что требует перезапуска
+func (s *Status) reloadConfig(w http.ResponseWriter, _ *http.Request) {
+	if s.reload == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("перезагрузка конфигурации недоступна"))
+
+		return
+	}
+
+	reloaded, err := s.reload()
+	if err != nil {
+		log.Errorf("не удалось перезагрузить конфигурацию: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	log.Infof("конфигурация перезагружена")
+	writeJSON(w, http.StatusOK, map[string]any{"status": "reloaded", "result": reloaded})
+}
+
+// POST /api/connections/{id}/close - закрыть соединение
+func (s *Status) closeConn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err = s.registry.Close(id); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, connection.ErrUnknownConn) {
+			code = http.StatusNotFound
+		}
+
+		writeError(w, code, err)
+
+		return
+	}
+
+	log.Infof("соединение %d закрыто через служебный сервер", id)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "closed"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		log.Errorf("не удалось отправить ответ служебного сервера: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// страница состояния; соединения закрываются запросом к API из браузера
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Состояние сервера</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+<script>
+function post(url) {
+	const token = sessionStorage.getItem("adminToken") || prompt("Токен служебного сервера");
+	if (!token) return;
+	fetch(url, {method: "POST", headers: {"X-Admin-Token": token}}).then(r => {
+		if (r.status == 401) sessionStorage.removeItem("adminToken");
+		else sessionStorage.setItem("adminToken", token);
+		return r.json();
+	}).then(d => {
+		if (d.error) alert(d.error);
+		location.reload();
+	});
+}
+</script>
+</head>
+<body>
+<h1>Состояние сервера</h1>
+<p>Запущен: {{.Started.Format "2006-01-02 15:04:05"}}, работает {{.Uptime}}</p>
+<p>Соединений: {{.Totals.Connections}} (открыто {{.Totals.Active}}), запросов: {{.Totals.Requests}},
+отправлено байт: {{.Totals.BytesSent}}</p>
+<p><button onclick="post('/api/reload')">Перезагрузить конфигурацию</button></p>
+<h2>Соединения</h2>
+<table>
+<tr><th>ID</th><th>ID запроса</th><th>Клиент</th><th>Запрос</th><th>Отправлено</th><th>Время</th><th>Состояние</th><th></th></tr>
+{{range .Connections}}<tr><td>{{.ID}}</td><td>{{.RequestID}}</td><td>{{.Client}}</td><td>{{.Method}} {{.Path}}</td><td>{{.BytesSent}}</td><td>{{.Age}}</td><td>{{.State}}</td>
+<td><button onclick="post('/api/connections/{{.ID}}/close')">Закрыть</button></td></tr>
+{{end}}</table>
+<h2>Конфигурация</h2>
+<pre>{{.ConfigJSON}}</pre>
+</body>
+</html>
+`))
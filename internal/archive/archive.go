@@ -0,0 +1,250 @@
+// Package archive - пакет для потоковой упаковки каталога в zip или tar.gz архив
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const (
+	// FormatZip - zip архив
+	FormatZip = "zip"
+	// FormatTarGz - tar архив, сжатый gzip
+	FormatTarGz = "tar.gz"
+)
+
+var (
+	// ErrUnknownFormat - запрошен неподдерживаемый формат архива
+	ErrUnknownFormat = errors.New("неподдерживаемый формат архива")
+	// ErrTooLarge - суммарный размер файлов каталога превышает допустимый
+	ErrTooLarge = errors.New("размер архива превышает допустимый")
+)
+
+// ContentType - возвращает MIME-тип архива
+func ContentType(format string) (string, error) {
+	switch format {
+	case FormatZip:
+		return "application/zip", nil
+	case FormatTarGz:
+		return "application/gzip", nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// Filter - решает, попадет ли в архив файл или каталог; rel - путь относительно архивируемого каталога
+// с разделителем '/', пустая строка - сам каталог. Каталог, не прошедший проверку, пропускается целиком
+type Filter func(rel string) bool
+
+// файл или каталог, попадающий в архив
+type entry struct {
+	// путь внутри архива, разделитель - '/'
+	name string
+	path string
+	info os.FileInfo
+}
+
+// Size - возвращает суммарный размер файлов, которые попадут в архив каталога; allow == nil - все файлы
+func Size(root string, allow Filter) (int64, error) {
+	var total int64
+
+	err := walk(root, filepath.Base(root), "", allow, func(e entry) error {
+		if e.info.Mode().IsRegular() {
+			total += e.info.Size()
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// Write - пишет в w архив каталога root; maxSize - ограничение суммарного размера файлов, 0 - без ограничения;
+// allow - какие файлы попадут в архив, nil - все
+func Write(w io.Writer, format, root string, maxSize int64, allow Filter) error {
+	// файлы могут вырасти уже после подсчета размера, поэтому ограничиваем запись содержимого
+	limit := &limiter{left: maxSize, unlimited: maxSize == 0}
+
+	switch format {
+	case FormatZip:
+		return writeZip(w, root, limit, allow)
+	case FormatTarGz:
+		return writeTarGz(w, root, limit, allow)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// пишем zip архив
+func writeZip(w io.Writer, root string, limit *limiter, allow Filter) error {
+	zw := zip.NewWriter(w)
+
+	err := walk(root, filepath.Base(root), "", allow, func(e entry) error {
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = e.name
+
+		if e.info.IsDir() {
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+
+			return err
+		}
+
+		hdr.Method = zip.Deflate
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		return copyFile(fw, e.path, limit)
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// пишем tar архив, сжатый gzip
+func writeTarGz(w io.Writer, root string, limit *limiter, allow Filter) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := walk(root, filepath.Base(root), "", allow, func(e entry) error {
+		hdr, err := tar.FileInfoHeader(e.info, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = e.name
+
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if e.info.IsDir() {
+			return nil
+		}
+
+		return copyFile(tw, e.path, limit)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// обходим каталог по тем же правилам, что и при выводе списка файлов:
+// скрытые файлы пропускаем, символические ссылки на файлы разыменовываем,
+// символические ссылки на каталоги пропускаем, чтобы не зациклиться;
+// rel - путь каталога относительно архивируемого, файлы, не прошедшие allow, пропускаем
+func walk(dir, name, rel string, allow Filter, fn func(entry) error) error {
+	if allow != nil && !allow(rel) {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(entry{name: name, path: dir, info: info}); err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range files {
+		if v.Name()[0] == '.' {
+			continue
+		}
+
+		p := filepath.Join(dir, v.Name())
+		n := path.Join(name, v.Name())
+		r := path.Join(rel, v.Name())
+
+		if v.IsDir() {
+			if err = walk(p, n, r, allow, fn); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fi, err := os.Stat(p)
+		// битые ссылки, ссылки на каталоги, сокеты и т.п. в архив не попадают
+		if err != nil || !fi.Mode().IsRegular() || (allow != nil && !allow(r)) {
+			continue
+		}
+
+		if err = fn(entry{name: n, path: p, info: fi}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// копируем содержимое файла в архив
+func copyFile(w io.Writer, path string, limit *limiter) error {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(limit.writer(w), f)
+
+	return err
+}
+
+// ограничение суммарного объема содержимого файлов в архиве
+type limiter struct {
+	left      int64
+	unlimited bool
+}
+
+func (l *limiter) writer(w io.Writer) io.Writer {
+	return &limitedWriter{w: w, l: l}
+}
+
+type limitedWriter struct {
+	w io.Writer
+	l *limiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if !lw.l.unlimited {
+		if int64(len(p)) > lw.l.left {
+			return 0, ErrTooLarge
+		}
+
+		lw.l.left -= int64(len(p))
+	}
+
+	return lw.w.Write(p)
+}
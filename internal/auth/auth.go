@@ -0,0 +1,150 @@
+// Package auth - пакет для HTTP-аутентификации Basic и Digest по файлам htpasswd и htdigest
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// SchemeBasic - аутентификация Basic по файлу htpasswd
+	SchemeBasic = "basic"
+	// SchemeDigest - аутентификация Digest по файлу htdigest
+	SchemeDigest = "digest"
+)
+
+var (
+	// ErrUnauthorized - клиент не прошел аутентификацию
+	ErrUnauthorized = errors.New("клиент не прошел аутентификацию")
+	// ErrUnknownScheme - указана неподдерживаемая схема аутентификации
+	ErrUnknownScheme = errors.New("неподдерживаемая схема аутентификации")
+)
+
+// Rule - правило аутентификации для запросов, путь которых начинается с префикса
+type Rule struct {
+	Prefix string
+	Realm  string
+	// Scheme - basic или digest
+	Scheme string
+	// File - путь до файла htpasswd (basic) или htdigest (digest)
+	File string
+}
+
+// правило с загруженным файлом пользователей
+type rule struct {
+	Rule
+	users *credFile
+}
+
+// Auth - набор правил аутентификации по префиксам пути
+type Auth struct {
+	// правила отсортированы по убыванию длины префикса
+	rules  []*rule
+	digest *digest
+}
+
+// New - создать набор правил аутентификации и загрузить файлы пользователей
+func New(rules []Rule) (*Auth, error) {
+	a := &Auth{
+		digest: newDigest(),
+	}
+
+	for _, v := range rules {
+		if v.Scheme != SchemeBasic && v.Scheme != SchemeDigest {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownScheme, v.Scheme)
+		}
+
+		users, err := loadCredFile(v.File)
+		if err != nil {
+			return nil, err
+		}
+
+		v.Prefix = "/" + strings.Trim(v.Prefix, "/")
+		a.rules = append(a.rules, &rule{Rule: v, users: users})
+	}
+
+	// при пересечении префиксов применяется правило с самым длинным префиксом
+	sort.SliceStable(a.rules, func(i, j int) bool {
+		return len(a.rules[i].Prefix) > len(a.rules[j].Prefix)
+	})
+
+	return a, nil
+}
+
+// Check - проверяет учетные данные из заголовка Authorization для запроса к пути path;
+// uri - цель запроса из строки запроса, нужна для Digest.
+// Возвращает имя пользователя или, если доступ запрещен, ErrUnauthorized и значение заголовка WWW-Authenticate.
+// Если путь не защищен, возвращает пустое имя пользователя без ошибки
+func (a *Auth) Check(method, path, uri, authorization string) (string, string, error) {
+	r := a.match(path)
+	if r == nil {
+		return "", "", nil
+	}
+
+	scheme, credentials, _ := strings.Cut(authorization, " ")
+
+	switch r.Scheme {
+	case SchemeBasic:
+		user, ok := r.checkBasic(scheme, credentials)
+		if !ok {
+			return "", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", r.Realm), ErrUnauthorized
+		}
+
+		return user, "", nil
+	default:
+		user, stale, ok := a.digest.check(r, method, uri, scheme, credentials)
+		if !ok {
+			return "", a.digest.challenge(r.Realm, stale), ErrUnauthorized
+		}
+
+		return user, "", nil
+	}
+}
+
+// SameRule - действует ли для путей a и b одно правило аутентификации или ни одного:
+// клиент, прошедший проверку для одного пути, прошел бы ее и для другого
+func (a *Auth) SameRule(pathA, pathB string) bool {
+	if a == nil {
+		return true
+	}
+
+	return a.match(pathA) == a.match(pathB)
+}
+
+// правило с самым длинным префиксом, под который попадает путь
+func (a *Auth) match(path string) *rule {
+	for _, r := range a.rules {
+		if r.Prefix == "/" || path == r.Prefix || strings.HasPrefix(path, r.Prefix+"/") {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// проверяем учетные данные Basic по файлу htpasswd
+func (r *rule) checkBasic(scheme, credentials string) (string, bool) {
+	if !strings.EqualFold(scheme, "Basic") {
+		return "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", false
+	}
+
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", false
+	}
+
+	hash, ok := r.users.get(user)
+	if !ok {
+		return "", false
+	}
+
+	return user, verifyPassword(hash, password)
+}
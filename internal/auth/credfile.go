@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+)
+
+// credFile - файл пользователей htpasswd (user:hash) или htdigest (user:realm:ha1),
+// перечитывается при изменении
+type credFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	// ключ - все поля строки, кроме последнего, значение - последнее поле
+	entries map[string]string
+}
+
+// загружаем файл пользователей
+func loadCredFile(path string) (*credFile, error) {
+	f := &credFile{path: path}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить файл пользователей: %w", err)
+	}
+
+	if err = f.load(fi); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// получаем значение по ключу, перед этим перечитываем файл, если он изменился
+func (f *credFile) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		// файл временно недоступен (например, заменяется) - используем загруженные данные
+		log.Errorf("файл пользователей %q недоступен: %v", f.path, err)
+	} else if !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size {
+		if err = f.load(fi); err != nil {
+			log.Errorf(err)
+		} else {
+			log.Infof("файл пользователей %q перечитан", f.path)
+		}
+	}
+
+	v, ok := f.entries[key]
+
+	return v, ok
+}
+
+// читаем файл пользователей; вызывается под мьютексом или до начала использования
+func (f *credFile) load(fi os.FileInfo) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("не удалось загрузить файл пользователей: %w", err)
+	}
+	defer file.Close()
+
+	entries := make(map[string]string)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// пропускаем пустые строки и комментарии
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		i := strings.LastIndex(line, ":")
+		if i <= 0 {
+			continue
+		}
+
+		entries[line[:i]] = line[i+1:]
+	}
+
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("не удалось загрузить файл пользователей %q: %w", f.path, err)
+	}
+
+	f.entries = entries
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+
+	return nil
+}
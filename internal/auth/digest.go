@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// время жизни nonce, после которого клиенту предлагается повторить запрос с новым nonce
+	nonceTTL = 5 * time.Minute
+	// размер метки времени и подписи в nonce
+	nonceTimeSize = 8
+	nonceSigSize  = 16
+	secretSize    = 32
+)
+
+// digest - проверка аутентификации Digest (RFC 7616, алгоритм MD5, qop=auth)
+type digest struct {
+	// секрет для подписи nonce, генерируется при запуске сервера
+	secret []byte
+	opaque string
+}
+
+func newDigest() *digest {
+	secret := make([]byte, secretSize)
+	// crypto/rand.Read не возвращает ошибок на поддерживаемых платформах
+	_, _ = rand.Read(secret)
+
+	opaque := md5.Sum(secret) //nolint:gosec
+
+	return &digest{
+		secret: secret,
+		opaque: hex.EncodeToString(opaque[:]),
+	}
+}
+
+// значение заголовка WWW-Authenticate; stale - nonce клиента устарел, пароль при этом верный
+func (d *digest) challenge(realm string, stale bool) string {
+	c := fmt.Sprintf("Digest realm=%q, qop=\"auth\", algorithm=MD5, nonce=%q, opaque=%q",
+		realm, d.nonce(time.Now()), d.opaque)
+	if stale {
+		c += ", stale=true"
+	}
+
+	return c
+}
+
+// nonce - метка времени, подписанная секретом сервера
+func (d *digest) nonce(t time.Time) string {
+	buf := make([]byte, nonceTimeSize, nonceTimeSize+nonceSigSize)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano())) //nolint:gosec
+
+	return base64.RawURLEncoding.EncodeToString(append(buf, d.sign(buf)...))
+}
+
+func (d *digest) sign(ts []byte) []byte {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(ts)
+
+	return mac.Sum(nil)[:nonceSigSize]
+}
+
+// проверяем nonce: подпись и время жизни
+func (d *digest) checkNonce(nonce string) (valid, stale bool) {
+	buf, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(buf) != nonceTimeSize+nonceSigSize {
+		return false, false
+	}
+
+	if !hmac.Equal(buf[nonceTimeSize:], d.sign(buf[:nonceTimeSize])) {
+		return false, false
+	}
+
+	issued := time.Unix(0, int64(binary.BigEndian.Uint64(buf[:nonceTimeSize]))) //nolint:gosec
+
+	return true, time.Since(issued) > nonceTTL
+}
+
+// проверяем учетные данные Digest по файлу htdigest
+func (d *digest) check(r *rule, method, uri, scheme, credentials string) (user string, stale, ok bool) {
+	if !strings.EqualFold(scheme, "Digest") {
+		return "", false, false
+	}
+
+	params := parseParams(credentials)
+
+	user = params["username"]
+	if user == "" || params["realm"] != r.Realm || params["uri"] != uri {
+		return "", false, false
+	}
+
+	if alg := params["algorithm"]; alg != "" && !strings.EqualFold(alg, "MD5") {
+		return "", false, false
+	}
+
+	valid, expired := d.checkNonce(params["nonce"])
+	if !valid {
+		return "", false, false
+	}
+
+	ha1, found := r.users.get(user + ":" + r.Realm)
+	if !found {
+		return "", false, false
+	}
+
+	ha2 := md5Hex(method + ":" + uri)
+
+	var expected string
+
+	switch params["qop"] {
+	case "auth":
+		expected = md5Hex(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+	case "":
+		expected = md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	default:
+		return "", false, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return "", false, false
+	}
+	// пароль верный, но nonce устарел - клиент повторит запрос с новым nonce
+	if expired {
+		return "", true, false
+	}
+
+	return user, false, true
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s)) //nolint:gosec
+
+	return hex.EncodeToString(sum[:])
+}
+
+// парсим параметры вида key=value, key="value" через запятую
+func parseParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, " ,") {
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimSpace(s[eq+1:])
+
+		var value string
+
+		if strings.HasPrefix(s, `"`) {
+			// значение в кавычках может содержать запятые и экранированные символы
+			var b strings.Builder
+
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+
+				b.WriteByte(s[i])
+			}
+
+			value = b.String()
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end == -1 {
+				end = len(s)
+			}
+
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+
+		params[key] = value
+	}
+
+	return params
+}
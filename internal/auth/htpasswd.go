@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/md5"  //nolint:gosec
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	apr1Prefix = "$apr1$"
+	sha1Prefix = "{SHA}"
+	// алфавит кодирования хешей crypt
+	itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// количество раундов APR1-MD5
+	apr1Rounds = 1000
+)
+
+// проверяем пароль по хешу из файла htpasswd: bcrypt, SHA1 или APR1-MD5
+func verifyPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, sha1Prefix):
+		sum := sha1.Sum([]byte(password)) //nolint:gosec
+		encoded := base64.StdEncoding.EncodeToString(sum[:])
+
+		return subtle.ConstantTimeCompare([]byte(hash[len(sha1Prefix):]), []byte(encoded)) == 1
+	case strings.HasPrefix(hash, apr1Prefix):
+		salt, _, ok := strings.Cut(hash[len(apr1Prefix):], "$")
+		if !ok {
+			return false
+		}
+
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(apr1(password, salt))) == 1
+	default:
+		// хранение паролей в открытом виде и crypt(3) не поддерживаем
+		return false
+	}
+}
+
+// вычисляем хеш APR1-MD5 (Apache MD5 crypt) пароля с солью
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password)) //nolint:gosec
+
+	h := md5.New() //nolint:gosec
+	h.Write([]byte(password + apr1Prefix + salt))
+
+	for i := len(pw); i > 0; i -= md5.Size {
+		h.Write(alt[:min(i, md5.Size)])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+
+	final := h.Sum(nil)
+
+	for i := range apr1Rounds {
+		h := md5.New() //nolint:gosec
+
+		if i&1 == 1 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+
+		if i&1 == 1 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+
+		final = h.Sum(nil)
+	}
+
+	var res strings.Builder
+
+	res.WriteString(apr1Prefix + salt + "$")
+
+	// байты хеша кодируются группами по три в порядке, заданном алгоритмом
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		v := uint(final[g[0]])<<16 | uint(final[g[1]])<<8 | uint(final[g[2]])
+		for range 4 {
+			res.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+
+	v := uint(final[11])
+	for range 2 {
+		res.WriteByte(itoa64[v&0x3f])
+		v >>= 6
+	}
+
+	return res.String()
+}
@@ -0,0 +1,369 @@
+// Package cgi - пакет с обработчиком, выполняющим CGI-скрипты по RFC 3875
+package cgi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/handler"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// время, которое дается скрипту на завершение после истечения Timeout
+	waitDelay = time.Second
+	// serverSoftware - значение SERVER_SOFTWARE
+	serverSoftware = "tcp_server"
+)
+
+// заголовки ответа скрипта, которые заменяются собственными заголовками сервера
+var ownHeaders = []string{"Server", "Date", "Connection", "Transfer-Encoding"}
+
+// ErrInvalidResponse - скрипт вернул некорректный ответ
+var ErrInvalidResponse = errors.New("некорректный ответ скрипта")
+
+// Config - параметры выполнения CGI-скриптов
+type Config struct {
+	// Root - каталог со скриптами
+	Root string
+	// Prefix - начало пути запроса, которое заменяется каталогом Root (alias);
+	// пустая строка - путь запроса добавляется к Root целиком (root)
+	Prefix string
+	// Extensions - расширения скриптов, например ".cgi"; пусто - выполняется любой файл
+	Extensions []string
+	// Timeout - максимальное время выполнения скрипта, по умолчанию 30s
+	Timeout time.Duration
+	// Env - дополнительные переменные окружения скрипта
+	Env map[string]string
+}
+
+// CGI - обработчик, выполняющий CGI-скрипты
+type CGI struct {
+	cfg Config
+}
+
+// New - создать обработчик, выполняющий скрипты из cfg.Root
+func New(cfg Config) *CGI {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &CGI{cfg: cfg}
+}
+
+// Script - скрипт, найденный по пути запроса
+type Script struct {
+	// File - путь до файла скрипта (SCRIPT_FILENAME)
+	File string
+	// Name - часть пути запроса до скрипта включительно (SCRIPT_NAME)
+	Name string
+	// PathInfo - часть пути запроса после скрипта (PATH_INFO)
+	PathInfo string
+	// PathTranslated - путь до файла, соответствующего PathInfo (PATH_TRANSLATED)
+	PathTranslated string
+}
+
+// ServeHTTP - выполнить скрипт и отправить клиенту его ответ
+func (c *CGI) ServeHTTP(w handler.ResponseWriter, r *handler.Request) {
+	s, ok := c.find(r.Path())
+	if !ok {
+		w.WriteHeader(consts.StatusNotFound)
+		r.Log().Errorf("CGI-скрипт для пути %q не найден", r.Path())
+
+		return
+	}
+
+	if len(c.cfg.Extensions) > 0 && !slices.Contains(c.cfg.Extensions, filepath.Ext(s.File)) {
+		w.WriteHeader(consts.StatusForbidden)
+		r.Log().Errorf("файл %q не является CGI-скриптом: расширение не разрешено", s.File)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.File) //nolint:gosec
+	cmd.Dir = filepath.Dir(s.File)
+	cmd.Env = append(Env(r, s), serverEnv()...)
+
+	for name, v := range c.cfg.Env {
+		cmd.Env = append(cmd.Env, name+"="+v)
+	}
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	// тело запроса передается скрипту по мере чтения из соединения
+	if length, err := strconv.ParseInt(r.Header("Content-Length"), 10, 64); err == nil && length > 0 {
+		cmd.Stdin = r.Body()
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("%v", err)
+
+		return
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("%v", err)
+
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("CGI-скрипт %q не запущен: %v", s.File, err)
+
+		return
+	}
+
+	r.Log().Infof("запущен CGI-скрипт %q", s.File)
+
+	// по истечении времени закрываем чтение вывода скрипта: процессы, унаследовавшие
+	// его stdout и stderr, не должны задерживать передачу ответа
+	stop := context.AfterFunc(ctx, func() {
+		_ = stdout.Close() //nolint:errcheck
+		_ = stderr.Close() //nolint:errcheck
+	})
+	defer stop()
+
+	// stderr скрипта пишем в лог построчно
+	logged := make(chan struct{})
+
+	go func() {
+		defer close(logged)
+
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			r.Log().Warnf("CGI-скрипт %q: %s", s.File, sc.Text())
+		}
+	}()
+
+	sendErr := SendResponse(w, r, bufio.NewReader(stdout))
+
+	// Wait закрывает каналы, поэтому сначала дочитываем stdout и stderr
+	_, _ = io.Copy(io.Discard, stdout) //nolint:errcheck
+	<-logged
+
+	waitErr := cmd.Wait()
+	timedOut := ctx.Err() != nil
+
+	switch {
+	case timedOut:
+		r.Log().Errorf("CGI-скрипт %q прерван: превышено время выполнения %v", s.File, c.cfg.Timeout)
+	case waitErr != nil:
+		r.Log().Errorf("CGI-скрипт %q завершился с ошибкой: %v", s.File, waitErr)
+	}
+
+	if sendErr != nil {
+		r.Log().Errorf("%v", sendErr)
+	}
+
+	switch {
+	// заголовки еще не отправлены - клиент получит ошибку
+	case errors.Is(sendErr, ErrInvalidResponse) && timedOut:
+		w.WriteHeader(consts.StatusGatewayTimeout)
+	case errors.Is(sendErr, ErrInvalidResponse):
+		w.WriteHeader(consts.StatusBadGateway)
+	// ответ уже передается: обрываем его, чтобы клиент не принял часть ответа за весь
+	case sendErr != nil || timedOut:
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// найти скрипт: первый существующий файл среди начальных частей пути запроса,
+// остаток пути передается скрипту в PATH_INFO
+func (c *CGI) find(urlPath string) (Script, bool) {
+	rel := strings.TrimPrefix(urlPath, c.cfg.Prefix)
+	parts := strings.Split(strings.Trim(rel, "/"), "/")
+
+	for i := 1; i <= len(parts); i++ {
+		relScript := "/" + strings.Join(parts[:i], "/")
+		file := filepath.Join(c.cfg.Root, relScript)
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return Script{}, false
+		}
+
+		if fi.IsDir() {
+			continue
+		}
+
+		if !fi.Mode().IsRegular() {
+			return Script{}, false
+		}
+
+		pathInfo := ""
+		if i < len(parts) {
+			pathInfo = "/" + strings.Join(parts[i:], "/")
+		}
+
+		s := Script{
+			File:     file,
+			Name:     path.Join(c.cfg.Prefix, relScript),
+			PathInfo: pathInfo,
+		}
+
+		if pathInfo != "" {
+			s.PathTranslated = filepath.Join(c.cfg.Root, pathInfo)
+		}
+
+		return s, true
+	}
+
+	return Script{}, false
+}
+
+// Env - переменные окружения скрипта s по RFC 3875 в виде NAME=value
+func Env(r *handler.Request, s Script) []string {
+	serverName, serverPort, err := net.SplitHostPort(r.Host())
+	if err != nil {
+		serverName = r.Host()
+		serverPort = "80"
+
+		if r.Scheme() == "https" {
+			serverPort = "443"
+		}
+	}
+
+	env := []string{
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_SOFTWARE=" + serverSoftware,
+		"SERVER_PROTOCOL=" + r.Protocol(),
+		"SERVER_NAME=" + serverName,
+		"SERVER_PORT=" + serverPort,
+		"REQUEST_METHOD=" + r.Method(),
+		"REQUEST_URI=" + r.RequestURI(),
+		"SCRIPT_NAME=" + s.Name,
+		"SCRIPT_FILENAME=" + s.File,
+		"PATH_INFO=" + s.PathInfo,
+		"QUERY_STRING=" + r.RawQuery(),
+		"REMOTE_ADDR=" + remoteAddr(r),
+		"REQUEST_ID=" + r.RequestID(),
+	}
+
+	if s.PathTranslated != "" {
+		env = append(env, "PATH_TRANSLATED="+s.PathTranslated)
+	}
+
+	if r.Scheme() == "https" {
+		env = append(env, "HTTPS=on")
+	}
+
+	if user := r.User(); user != "" {
+		env = append(env, "REMOTE_USER="+user)
+
+		if scheme, _, ok := strings.Cut(r.Header("Authorization"), " "); ok {
+			env = append(env, "AUTH_TYPE="+scheme)
+		}
+	}
+
+	for name, v := range r.Headers() {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+
+		switch name {
+		case "Content-Length", "Content-Type":
+			env = append(env, strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"="+v)
+
+			continue
+		case "Authorization", "Proxy":
+			// учетные данные клиента скрипту не передаем; HTTP_PROXY меняет прокси в окружении скрипта
+			continue
+		}
+
+		env = append(env, "HTTP_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"="+v)
+	}
+
+	return env
+}
+
+// окружение сервера, без которого скрипты не найдут интерпретатор и библиотеки
+func serverEnv() []string {
+	var env []string
+
+	for _, name := range []string{"PATH", "LD_LIBRARY_PATH", "TZ", "SYSTEMROOT"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+
+	return env
+}
+
+// адрес клиента без порта
+func remoteAddr(r *handler.Request) string {
+	if ip := r.ClientIP(); ip != nil {
+		return ip.String()
+	}
+
+	return r.RemoteAddr()
+}
+
+// SendResponse - разобрать заголовки ответа скрипта (Status, Location, Content-Type) и отправить
+// ответ клиенту; ErrInvalidResponse - заголовки не разобраны и клиенту ничего не отправлено
+func SendResponse(w handler.ResponseWriter, r *handler.Request, out *bufio.Reader) error {
+	header, err := textproto.NewReader(out).ReadMIMEHeader()
+	if err != nil {
+		return fmt.Errorf("%w: заголовки не прочитаны: %w", ErrInvalidResponse, err)
+	}
+
+	code := consts.StatusOK
+
+	if status := header.Get("Status"); status != "" {
+		code, err = strconv.Atoi(strings.Fields(status + " ")[0])
+		if err != nil || code < 100 || code > 999 {
+			return fmt.Errorf("%w: статус %q", ErrInvalidResponse, status)
+		}
+
+		header.Del("Status")
+	} else if header.Get("Location") != "" {
+		// перенаправление без статуса, RFC 3875 6.2.3
+		code = consts.StatusFound
+	}
+
+	if header.Get("Content-Type") == "" && header.Get("Location") == "" {
+		return fmt.Errorf("%w: нет ни Content-Type, ни Location", ErrInvalidResponse)
+	}
+
+	// эти заголовки сервер пишет сам
+	for _, name := range ownHeaders {
+		header.Del(name)
+	}
+
+	for name, values := range header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+
+	w.WriteHeader(code)
+
+	n, err := io.Copy(w, out)
+	if err != nil {
+		return fmt.Errorf("ответ скрипта передан не полностью: %w", err)
+	}
+
+	r.Log().Infof("клиенту передан ответ скрипта: %d, %d байт", code, n)
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package cgi
+
+import "os/exec"
+
+// на этой платформе группы процессов не поддерживаются: по истечении времени завершается только скрипт
+func setProcessGroup(_ *exec.Cmd) {}
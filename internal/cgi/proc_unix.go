@@ -0,0 +1,24 @@
+//go:build unix
+
+package cgi
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// запускать скрипт в отдельной группе процессов, чтобы по истечении времени
+// завершить вместе с ним и запущенные им процессы
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+
+		return err
+	}
+}
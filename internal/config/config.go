@@ -2,9 +2,20 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"net"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/acl"
+	"github.com/Kostushka/tcp_server/internal/auth"
+	"github.com/Kostushka/tcp_server/internal/ratelimit"
+	"github.com/Kostushka/tcp_server/internal/realip"
+	"github.com/Kostushka/tcp_server/internal/rotate"
+	"github.com/Kostushka/tcp_server/internal/throttle"
 )
 
 var (
@@ -12,17 +23,70 @@ var (
 	ErrNoRootDir = errors.New("не указан путь до *корневого* каталога")
 	// ErrInvalidAddr - указан некорректный IP-адрес
 	ErrInvalidAddr = errors.New("указан некорректный IP-адрес")
+	// ErrInvalidAuth - некорректное правило аутентификации
+	ErrInvalidAuth = errors.New("некорректное правило аутентификации")
+	// ErrNoProxyProtocolFrom - PROXY protocol включен, но не указаны балансировщики, которым доверяем
+	ErrNoProxyProtocolFrom = errors.New("для -proxy-protocol нужно указать -proxy-protocol-from")
 )
 
-const portNumber = 5000
+const (
+	portNumber = 5000
+	// максимальный размер файла, помещаемого в кеш, по умолчанию - 1 Мб
+	defaultCacheMaxEntry = 1 << 20
+	// время жизни записи в кеше по умолчанию
+	defaultCacheTTL = 5 * time.Minute
+	// количество файлов на странице со списком файлов каталога по умолчанию
+	defaultPerPage = 500
+	// максимальный суммарный размер файлов в архиве каталога по умолчанию - 1 Гб
+	defaultArchiveMaxSize = 1 << 30
+	// время ожидания заголовка PROXY protocol по умолчанию
+	defaultProxyProtocolTimeout = 5 * time.Second
+	// количество запросов подряд сверх ограничения частоты по умолчанию
+	defaultRateBurst = 20
+	// длина префикса подсети клиента по умолчанию для IPv4 и IPv6
+	defaultSubnetV4 = 24
+	defaultSubnetV6 = 64
+	// количество хранимых ротированных файлов лога по умолчанию
+	defaultLogMaxBackups = 7
+)
 
 // Data - данные для конфигурации сервера
 type Data struct {
-	rootPath      string
-	listenAddress net.IP
-	port          int
-	log           string
-	fileTemplate  string
+	rootPath       string
+	listenAddress  net.IP
+	port           int
+	log            string
+	logLevel       string
+	logFormat      string
+	fileTemplate   string
+	markdown       bool
+	mdTemplate     string
+	ssi            []string
+	cacheSize      int64
+	cacheMaxEntry  int64
+	cacheTTL       time.Duration
+	dirCache       int
+	perPage        int
+	archiveMaxSize int64
+	authRules      []auth.Rule
+	accessLists    []acl.List
+	trustedProxies []*net.IPNet
+
+	proxyProtocol        bool
+	proxyProtocolFrom    []*net.IPNet
+	proxyProtocolTimeout time.Duration
+
+	rateLimit ratelimit.Config
+	bandwidth throttle.Config
+
+	accessLog       string
+	accessLogFormat string
+	logRotate       rotate.Config
+	adminAddr       string
+	adminToken      string
+
+	siteFile string
+	site     *Site
 }
 
 // RootPath - возвращает путь до домашнего каталога
@@ -45,11 +109,141 @@ func (c *Data) Log() string {
 	return c.log
 }
 
+// LogLevel - возвращает минимальный уровень логирования
+func (c *Data) LogLevel() string {
+	return c.logLevel
+}
+
+// LogFormat - возвращает формат лога: text или json
+func (c *Data) LogFormat() string {
+	return c.logFormat
+}
+
 // FileTemplate - возвращает путь до файла шаблона с отображением имен файлов
 func (c *Data) FileTemplate() string {
 	return c.fileTemplate
 }
 
+// Markdown - возвращает true, если файлы .md отдаются страницами HTML
+func (c *Data) Markdown() bool {
+	return c.markdown
+}
+
+// MarkdownTemplate - возвращает путь до файла шаблона страницы Markdown
+func (c *Data) MarkdownTemplate() string {
+	return c.mdTemplate
+}
+
+// SSI - возвращает расширения файлов, в которых выполняются директивы Server-Side Includes
+func (c *Data) SSI() []string {
+	return c.ssi
+}
+
+// CacheSize - возвращает суммарный объем кеша файлов в байтах, 0 - кеш отключен
+func (c *Data) CacheSize() int64 {
+	return c.cacheSize
+}
+
+// CacheMaxEntry - возвращает максимальный размер файла, помещаемого в кеш
+func (c *Data) CacheMaxEntry() int64 {
+	return c.cacheMaxEntry
+}
+
+// CacheTTL - возвращает время жизни записи в кеше файлов
+func (c *Data) CacheTTL() time.Duration {
+	return c.cacheTTL
+}
+
+// DirCache - возвращает максимальное количество каталогов в кеше содержимого каталогов, 0 - кеш отключен
+func (c *Data) DirCache() int {
+	return c.dirCache
+}
+
+// PerPage - возвращает количество файлов на странице со списком файлов каталога по умолчанию
+func (c *Data) PerPage() int {
+	return c.perPage
+}
+
+// ArchiveMaxSize - возвращает максимальный суммарный размер файлов в архиве каталога, 0 - без ограничения
+func (c *Data) ArchiveMaxSize() int64 {
+	return c.archiveMaxSize
+}
+
+// AuthRules - возвращает правила аутентификации по префиксам пути
+func (c *Data) AuthRules() []auth.Rule {
+	return c.authRules
+}
+
+// AccessLists - возвращает списки правил доступа по IP-адресам клиентов
+func (c *Data) AccessLists() []acl.List {
+	return c.accessLists
+}
+
+// TrustedProxies - возвращает подсети доверенных прокси, от которых принимаются заголовки X-Forwarded-* и Forwarded
+func (c *Data) TrustedProxies() []*net.IPNet {
+	return c.trustedProxies
+}
+
+// ProxyProtocol - возвращает, ожидать ли заголовок PROXY protocol в начале соединений
+func (c *Data) ProxyProtocol() bool {
+	return c.proxyProtocol
+}
+
+// ProxyProtocolFrom - возвращает подсети, от которых принимается заголовок PROXY protocol
+func (c *Data) ProxyProtocolFrom() []*net.IPNet {
+	return c.proxyProtocolFrom
+}
+
+// ProxyProtocolTimeout - возвращает время ожидания заголовка PROXY protocol
+func (c *Data) ProxyProtocolTimeout() time.Duration {
+	return c.proxyProtocolTimeout
+}
+
+// RateLimit - возвращает ограничения частоты запросов и количества соединений клиентов
+func (c *Data) RateLimit() ratelimit.Config {
+	return c.rateLimit
+}
+
+// Bandwidth - возвращает ограничения скорости отдачи данных клиентам
+func (c *Data) Bandwidth() throttle.Config {
+	return c.bandwidth
+}
+
+// AccessLog - возвращает имя файла журнала запросов или ”, если журнал не пишется
+func (c *Data) AccessLog() string {
+	return c.accessLog
+}
+
+// AccessLogFormat - возвращает формат журнала запросов: common, combined или строка с %-директивами
+func (c *Data) AccessLogFormat() string {
+	return c.accessLogFormat
+}
+
+// LogRotate - возвращает параметры ротации файлов лога и журнала запросов
+func (c *Data) LogRotate() rotate.Config {
+	return c.logRotate
+}
+
+// AdminAddr - возвращает адрес служебного сервера с метриками или ”, если он отключен
+func (c *Data) AdminAddr() string {
+	return c.adminAddr
+}
+
+// AdminToken - возвращает токен изменяющих запросов к API служебного сервера, пустая строка - создается случайный
+func (c *Data) AdminToken() string {
+	return c.adminToken
+}
+
+// SiteFile - возвращает путь до файла конфигурации сайта, пустая строка - файл не задан
+func (c *Data) SiteFile() string {
+	return c.siteFile
+}
+
+// Site - возвращает настройки сайта, прочитанные при запуске
+func (c *Data) Site() *Site {
+	return c.site
+}
+
 // NewConfigData - функция-конструктор для получения структуры с конфигурационными данными
 func NewConfigData() (*Data, error) {
 	// должен быть указан путь до домашнего каталога
@@ -72,11 +266,153 @@ func NewConfigData() (*Data, error) {
 
 	flag.StringVar(&log, "log", "", "output log to file")
 
+	// может быть указан минимальный уровень логирования и формат лога
+	var logLevel string
+
+	flag.StringVar(&logLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+
+	var logFormat string
+
+	flag.StringVar(&logFormat, "log-format", "text", "log format: text or json")
+
 	// должен быть указан путь до файла шаблона с отображением имен файлов
 	var fileTemplate string
 
 	flag.StringVar(&fileTemplate, "templ", "./html/filesPage.html", "template for displaying file names")
 
+	// файлы Markdown могут отдаваться страницами HTML, исходный текст - с параметром ?raw=1
+	var markdown bool
+
+	flag.BoolVar(&markdown, "markdown", false, "render .md files as HTML pages, ?raw=1 returns the source")
+
+	var mdTemplate string
+
+	flag.StringVar(&mdTemplate, "md-templ", "./html/markdownPage.html", "template for rendered Markdown pages")
+
+	// могут быть указаны расширения файлов с директивами SSI, по умолчанию SSI отключено
+	var ssiExtensions string
+
+	flag.StringVar(&ssiExtensions, "ssi", "", "comma-separated file extensions processed as Server-Side Includes (e.g. .shtml)")
+
+	// может быть указан объем кеша файлов, по умолчанию кеш отключен
+	var cacheSize int64
+
+	flag.Int64Var(&cacheSize, "cache-size", 0, "file cache size in bytes, 0 disables the cache")
+
+	var cacheMaxEntry int64
+
+	flag.Int64Var(&cacheMaxEntry, "cache-max-entry", defaultCacheMaxEntry, "max size of a cached file in bytes")
+
+	var cacheTTL time.Duration
+
+	flag.DurationVar(&cacheTTL, "cache-ttl", defaultCacheTTL, "lifetime of a file cache entry, 0 means no limit")
+
+	// может быть указан размер кеша содержимого каталогов, по умолчанию кеш отключен
+	var dirCache int
+
+	flag.IntVar(&dirCache, "dir-cache", 0, "max number of directories in the listing cache, 0 disables the cache")
+
+	// может быть указано количество файлов на странице со списком файлов каталога
+	var perPage int
+
+	flag.IntVar(&perPage, "per-page", defaultPerPage, "files per directory listing page, 0 disables pagination")
+
+	// может быть указан максимальный размер архива при скачивании каталога
+	var archiveMaxSize int64
+
+	flag.Int64Var(&archiveMaxSize, "archive-max-size", defaultArchiveMaxSize,
+		"max total size of files in a directory archive in bytes, 0 means no limit")
+
+	// могут быть указаны правила аутентификации, флаг повторяется для каждого префикса пути
+	var authRules authFlag
+
+	flag.Var(&authRules, "auth",
+		"auth rule `prefix=/path,realm=name,type=basic|digest,file=htpasswd`, may be repeated")
+
+	// могут быть указаны правила доступа по IP-адресам, флаг повторяется для каждого префикса пути
+	var accessLists aclFlag
+
+	flag.Var(&accessLists, "acl",
+		"access rules `[/prefix:]allow CIDR,deny all`, evaluated in order; if no rule for the longest matching prefix "+
+			"applies, shorter prefixes are checked down to the rules without a prefix; may be repeated")
+
+	// могут быть указаны доверенные прокси, иначе заголовки X-Forwarded-* и Forwarded игнорируются
+	var trustedProxies string
+
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated list of trusted proxy addresses and CIDRs")
+
+	// может быть включен разбор заголовка PROXY protocol от балансировщиков уровня TCP
+	var proxyProtocol bool
+
+	flag.BoolVar(&proxyProtocol, "proxy-protocol", false, "expect PROXY protocol v1/v2 header on accepted connections")
+
+	var proxyProtocolFrom string
+
+	flag.StringVar(&proxyProtocolFrom, "proxy-protocol-from", "",
+		"comma-separated list of addresses and CIDRs allowed to send PROXY protocol header, required with -proxy-protocol")
+
+	var proxyProtocolTimeout time.Duration
+
+	flag.DurationVar(&proxyProtocolTimeout, "proxy-protocol-timeout", defaultProxyProtocolTimeout,
+		"timeout for reading PROXY protocol header")
+
+	// могут быть указаны ограничения частоты запросов и количества соединений клиентов
+	var rateLimit ratelimit.Config
+
+	flag.Float64Var(&rateLimit.Rate, "rate", 0, "requests per second allowed from one client address, 0 means no limit")
+	flag.IntVar(&rateLimit.Burst, "rate-burst", defaultRateBurst, "requests allowed in a burst above -rate")
+	flag.IntVar(&rateLimit.MaxConnsPerIP, "max-conns-per-ip", 0,
+		"concurrent connections allowed from one client address, 0 means no limit")
+	flag.IntVar(&rateLimit.MaxConnsPerSubnet, "max-conns-per-subnet", 0,
+		"concurrent connections allowed from one client subnet, 0 means no limit")
+	flag.IntVar(&rateLimit.SubnetV4, "subnet-v4", defaultSubnetV4, "IPv4 client subnet prefix length")
+	flag.IntVar(&rateLimit.SubnetV6, "subnet-v6", defaultSubnetV6, "IPv6 client subnet prefix length")
+
+	// могут быть указаны ограничения скорости отдачи данных в байтах в секунду
+	var bandwidth throttle.Config
+
+	flag.Int64Var(&bandwidth.PerConn, "limit-rate", 0, "bytes per second for one connection, 0 means no limit")
+	flag.Int64Var(&bandwidth.PerIP, "limit-rate-ip", 0,
+		"bytes per second for all connections of one client address, 0 means no limit")
+	flag.Int64Var(&bandwidth.Global, "limit-rate-global", 0, "bytes per second for the whole server, 0 means no limit")
+	flag.Int64Var(&bandwidth.Burst, "limit-rate-burst", 0, "bytes allowed in a burst, 0 means one second worth of data")
+	flag.Int64Var(&bandwidth.After, "limit-rate-after", 0, "bytes sent without limit at the start of each connection")
+
+	// может быть указан файл журнала запросов, отдельный от лога ошибок
+	var accessLog string
+
+	flag.StringVar(&accessLog, "access-log", "", "write access log to file")
+
+	var accessLogFormat string
+
+	flag.StringVar(&accessLogFormat, "access-log-format", "combined",
+		"access log format: common, combined or a custom %-directive format string")
+
+	// могут быть указаны параметры ротации файлов лога и журнала запросов
+	var logRotate rotate.Config
+
+	flag.Int64Var(&logRotate.MaxSize, "log-max-size", 0, "rotate log files larger than this many bytes, 0 disables")
+	flag.DurationVar(&logRotate.Interval, "log-rotate-interval", 0, "rotate log files this often, 0 disables")
+	flag.IntVar(&logRotate.MaxBackups, "log-max-backups", defaultLogMaxBackups,
+		"number of rotated log files to keep, 0 keeps all")
+	flag.BoolVar(&logRotate.Compress, "log-compress", false, "gzip rotated log files")
+
+	// может быть указан адрес служебного сервера с метриками, без хоста он слушает только localhost
+	var adminAddr string
+
+	flag.StringVar(&adminAddr, "admin", "", "admin listener address (e.g. :9090) serving /metrics, /status and /api, empty disables it")
+
+	// изменяющие запросы к API служебного сервера принимаются только с токеном
+	var adminToken string
+
+	flag.StringVar(&adminToken, "admin-token", "",
+		"token required in X-Admin-Token header by admin API POST requests, empty generates a random one written to the log")
+
+	// может быть указан файл конфигурации сайта с location
+	var siteFile string
+
+	flag.StringVar(&siteFile, "conf", "", "site configuration file (JSON) with locations, reloaded by the admin API")
+
 	flag.Parse()
 
 	// должен быть указан путь до домашнего каталога
@@ -90,11 +426,203 @@ func NewConfigData() (*Data, error) {
 		return nil, ErrInvalidAddr
 	}
 
+	trusted, err := realip.ParseNets(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyFrom, err := realip.ParseNets(proxyProtocolFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	// иначе любой клиент сможет подставить чужой адрес и обойти ACL и ограничения частоты
+	if proxyProtocol && len(proxyFrom) == 0 {
+		return nil, ErrNoProxyProtocolFrom
+	}
+
+	site, err := LoadSite(siteFile)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Data{
-		rootPath:      rootPath,
-		listenAddress: addr,
-		port:          port,
-		log:           log,
-		fileTemplate:  fileTemplate,
+		rootPath:       rootPath,
+		listenAddress:  addr,
+		port:           port,
+		log:            log,
+		logLevel:       logLevel,
+		logFormat:      logFormat,
+		fileTemplate:   fileTemplate,
+		markdown:       markdown,
+		mdTemplate:     mdTemplate,
+		ssi:            strings.FieldsFunc(ssiExtensions, func(r rune) bool { return r == ',' || r == ' ' }),
+		cacheSize:      cacheSize,
+		cacheMaxEntry:  cacheMaxEntry,
+		cacheTTL:       cacheTTL,
+		dirCache:       dirCache,
+		perPage:        perPage,
+		archiveMaxSize: archiveMaxSize,
+		authRules:      authRules,
+		accessLists:    accessLists,
+		trustedProxies: trusted,
+
+		proxyProtocol:        proxyProtocol,
+		proxyProtocolFrom:    proxyFrom,
+		proxyProtocolTimeout: proxyProtocolTimeout,
+
+		rateLimit: rateLimit,
+		bandwidth: bandwidth,
+
+		accessLog:       accessLog,
+		accessLogFormat: accessLogFormat,
+		logRotate:       logRotate,
+		adminAddr:       adminAddr,
+		adminToken:      adminToken,
+
+		siteFile: siteFile,
+		site:     site,
 	}, nil
 }
+
+// authFlag - повторяемый флаг с правилами аутентификации
+type authFlag []auth.Rule
+
+func (a *authFlag) String() string {
+	rules := make([]string, 0, len(*a))
+	for _, v := range *a {
+		rules = append(rules, fmt.Sprintf("prefix=%s,realm=%s,type=%s,file=%s", v.Prefix, v.Realm, v.Scheme, v.File))
+	}
+
+	return strings.Join(rules, " ")
+}
+
+// Set - парсим правило вида prefix=/path,realm=name,type=basic|digest,file=htpasswd
+func (a *authFlag) Set(value string) error {
+	rule := auth.Rule{
+		Prefix: "/",
+		Scheme: auth.SchemeBasic,
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidAuth, value)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "prefix":
+			rule.Prefix = val
+		case "realm":
+			rule.Realm = val
+		case "type":
+			rule.Scheme = strings.ToLower(val)
+		case "file":
+			rule.File = val
+		default:
+			return fmt.Errorf("%w: неизвестный параметр %q", ErrInvalidAuth, key)
+		}
+	}
+
+	if rule.File == "" {
+		return fmt.Errorf("%w: не указан файл пользователей", ErrInvalidAuth)
+	}
+
+	if rule.Realm == "" {
+		rule.Realm = rule.Prefix
+	}
+
+	*a = append(*a, rule)
+
+	return nil
+}
+
+// aclFlag - повторяемый флаг со списками правил доступа
+type aclFlag []acl.List
+
+func (a *aclFlag) String() string {
+	lists := make([]string, 0, len(*a))
+
+	for _, v := range *a {
+		rules := make([]string, 0, len(v.Rules))
+		for _, r := range v.Rules {
+			rules = append(rules, r.String())
+		}
+
+		lists = append(lists, v.Prefix+":"+strings.Join(rules, ","))
+	}
+
+	return strings.Join(lists, " ")
+}
+
+// Set - парсим список правил вида [/prefix:]allow 10.0.0.0/8,deny all
+func (a *aclFlag) Set(value string) error {
+	list, err := acl.ParseList(value)
+	if err != nil {
+		return err
+	}
+
+	*a = append(*a, list)
+
+	return nil
+}
+
+// MarshalJSON - действующая конфигурация сервера; ключи совпадают с именами флагов
+func (c *Data) MarshalJSON() ([]byte, error) {
+	nets := func(list []*net.IPNet) []string {
+		s := make([]string, 0, len(list))
+		for _, v := range list {
+			s = append(s, v.String())
+		}
+
+		return s
+	}
+
+	authRules := authFlag(c.authRules)
+	accessLists := aclFlag(c.accessLists)
+
+	return json.Marshal(map[string]any{
+		"path":                   c.rootPath,
+		"IP":                     c.listenAddress.String(),
+		"port":                   c.port,
+		"log":                    c.log,
+		"log-level":              c.logLevel,
+		"log-format":             c.logFormat,
+		"templ":                  c.fileTemplate,
+		"markdown":               c.markdown,
+		"md-templ":               c.mdTemplate,
+		"ssi":                    c.ssi,
+		"cache-size":             c.cacheSize,
+		"cache-max-entry":        c.cacheMaxEntry,
+		"cache-ttl":              c.cacheTTL.String(),
+		"dir-cache":              c.dirCache,
+		"per-page":               c.perPage,
+		"archive-max-size":       c.archiveMaxSize,
+		"auth":                   authRules.String(),
+		"acl":                    accessLists.String(),
+		"trusted-proxies":        nets(c.trustedProxies),
+		"proxy-protocol":         c.proxyProtocol,
+		"proxy-protocol-from":    nets(c.proxyProtocolFrom),
+		"proxy-protocol-timeout": c.proxyProtocolTimeout.String(),
+		"rate":                   c.rateLimit.Rate,
+		"rate-burst":             c.rateLimit.Burst,
+		"max-conns-per-ip":       c.rateLimit.MaxConnsPerIP,
+		"max-conns-per-subnet":   c.rateLimit.MaxConnsPerSubnet,
+		"subnet-v4":              c.rateLimit.SubnetV4,
+		"subnet-v6":              c.rateLimit.SubnetV6,
+		"limit-rate":             c.bandwidth.PerConn,
+		"limit-rate-ip":          c.bandwidth.PerIP,
+		"limit-rate-global":      c.bandwidth.Global,
+		"limit-rate-burst":       c.bandwidth.Burst,
+		"limit-rate-after":       c.bandwidth.After,
+		"access-log":             c.accessLog,
+		"access-log-format":      c.accessLogFormat,
+		"log-max-size":           c.logRotate.MaxSize,
+		"log-rotate-interval":    c.logRotate.Interval.String(),
+		"log-max-backups":        c.logRotate.MaxBackups,
+		"log-compress":           c.logRotate.Compress,
+		"admin":                  c.adminAddr,
+		"conf":                   c.siteFile,
+		"site":                   c.site,
+	})
+}
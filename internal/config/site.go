@@ -0,0 +1,51 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+	"github.com/Kostushka/tcp_server/internal/location"
+	"github.com/Kostushka/tcp_server/internal/rewrite"
+	"github.com/Kostushka/tcp_server/internal/vhost"
+)
+
+// Site - настройки сайта из файла конфигурации
+type Site struct {
+	// Locations - location в стиле nginx; для виртуальных хостов - location по умолчанию
+	Locations []location.Config `json:"locations,omitempty"`
+	// Rewrites - правила перезаписи пути запроса; для виртуальных хостов - правила по умолчанию
+	Rewrites []rewrite.Config `json:"rewrites,omitempty"`
+	// ErrorPages - шаблоны страниц ошибок: {"404": "404.html", "5xx": "error.json"}
+	ErrorPages errorpage.Config `json:"error_pages,omitempty"`
+	// Hosts - виртуальные хосты, выбираемые по заголовку Host
+	Hosts []vhost.Config `json:"hosts,omitempty"`
+	// UnknownHost - ответ на запрос к неизвестному хосту, если хост по умолчанию не задан: 421 или 404
+	UnknownHost int `json:"unknown_host,omitempty"`
+}
+
+// LoadSite - прочитать файл конфигурации сайта; для пустого пути возвращаются пустые настройки
+func LoadSite(path string) (*Site, error) {
+	site := &Site{}
+
+	if path == "" {
+		return site, nil
+	}
+
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// опечатка в имени параметра не должна молча отключать настройку
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	if err = dec.Decode(site); err != nil {
+		return nil, fmt.Errorf("некорректный файл конфигурации %q: %w", path, err)
+	}
+
+	return site, nil
+}
@@ -7,44 +7,242 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"io/fs"
+	"math"
 	"net"
-	"os"
-	"path/filepath"
-
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/accesslog"
+	"github.com/Kostushka/tcp_server/internal/acl"
+	"github.com/Kostushka/tcp_server/internal/auth"
 	"github.com/Kostushka/tcp_server/internal/connection/consts"
 	"github.com/Kostushka/tcp_server/internal/connection/headerdata"
 	"github.com/Kostushka/tcp_server/internal/connection/types"
 	"github.com/Kostushka/tcp_server/internal/dir"
-	"github.com/Kostushka/tcp_server/internal/file"
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+	"github.com/Kostushka/tcp_server/internal/filecache"
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/location"
 	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/markdown"
+	"github.com/Kostushka/tcp_server/internal/metrics"
 	"github.com/Kostushka/tcp_server/internal/querydata"
+	"github.com/Kostushka/tcp_server/internal/ratelimit"
+	"github.com/Kostushka/tcp_server/internal/realip"
+	"github.com/Kostushka/tcp_server/internal/requestid"
+	"github.com/Kostushka/tcp_server/internal/rewrite"
+	"github.com/Kostushka/tcp_server/internal/ssi"
+	"github.com/Kostushka/tcp_server/internal/static"
+	"github.com/Kostushka/tcp_server/internal/throttle"
+	"github.com/Kostushka/tcp_server/internal/vhost"
 )
 
+// Settings - общие для всех соединений данные сервера
+type Settings struct {
+	RootPath string
+	// шаблон страницы со списком файлов, может быть заменен при перезагрузке конфигурации
+	template atomic.Pointer[template.Template]
+	// таблица location, может быть заменена при перезагрузке конфигурации
+	router atomic.Pointer[location.Router]
+	// правила перезаписи пути запроса, могут быть заменены при перезагрузке конфигурации
+	rewrites atomic.Pointer[rewrite.Rules]
+	// страницы ошибок, могут быть заменены при перезагрузке конфигурации
+	errorPages atomic.Pointer[errorpage.Pages]
+	// виртуальные хосты, могут быть заменены при перезагрузке конфигурации
+	hosts atomic.Pointer[vhost.Table]
+	// FileCache - кеш содержимого файлов, nil - кеш отключен
+	FileCache *filecache.Cache
+	// DirCache - кеш содержимого каталогов, nil - кеш отключен
+	DirCache *dir.Cache
+	// PerPage - количество файлов на странице со списком файлов каталога по умолчанию
+	PerPage int
+	// ArchiveMaxSize - максимальный суммарный размер файлов в архиве каталога, 0 - без ограничения
+	ArchiveMaxSize int64
+	// Markdown - отрисовывает файлы Markdown в страницы HTML, nil - отрисовка недоступна
+	Markdown *markdown.Renderer
+	// RenderMarkdown - отдавать файлы .md из RootPath страницами HTML
+	RenderMarkdown bool
+	// SSI - выполняет директивы Server-Side Includes в файлах с заданными расширениями, nil - SSI отключено
+	SSI *ssi.Processor
+	// Auth - правила аутентификации, nil - аутентификация не требуется
+	Auth *auth.Auth
+	// ACL - правила доступа по IP-адресам клиентов, nil - доступ не ограничен
+	ACL *acl.ACL
+	// RealIP - определяет адрес клиента за доверенными прокси, nil - прокси не доверяем
+	RealIP *realip.Resolver
+	// Limiter - ограничения частоты запросов и количества соединений клиентов, nil - без ограничений
+	Limiter *ratelimit.Limiter
+	// Throttle - ограничения скорости отдачи данных, nil - без ограничений
+	Throttle *throttle.Throttle
+	// AccessLog - журнал запросов, nil - журнал не пишется
+	AccessLog *accesslog.Logger
+	// Metrics - счетчики работы сервера, nil - счетчики не ведутся
+	Metrics *metrics.Metrics
+	// Registry - список открытых соединений для страницы состояния, nil - список не ведется
+	Registry *Registry
+	// Handler - обработчик запросов, прошедших проверки доступа; nil - отдача файлов из RootPath
+	Handler handler.Handler
+}
+
+// Template - возвращает текущий шаблон страницы со списком файлов
+func (s *Settings) Template() *template.Template {
+	return s.template.Load()
+}
+
+// SetTemplate - заменяет шаблон страницы со списком файлов для новых соединений
+func (s *Settings) SetTemplate(t *template.Template) {
+	s.template.Store(t)
+}
+
+// Router - возвращает текущую таблицу location, nil - location не заданы
+func (s *Settings) Router() *location.Router {
+	return s.router.Load()
+}
+
+// SetRouter - заменяет таблицу location для новых соединений
+func (s *Settings) SetRouter(r *location.Router) {
+	s.router.Store(r)
+}
+
+// Rewrites - возвращает текущие правила перезаписи, nil - правила не заданы
+func (s *Settings) Rewrites() *rewrite.Rules {
+	return s.rewrites.Load()
+}
+
+// SetRewrites - заменяет правила перезаписи для новых соединений
+func (s *Settings) SetRewrites(r *rewrite.Rules) {
+	s.rewrites.Store(r)
+}
+
+// ErrorPages - возвращает текущие страницы ошибок, nil - только встроенные страницы
+func (s *Settings) ErrorPages() *errorpage.Pages {
+	return s.errorPages.Load()
+}
+
+// SetErrorPages - заменяет страницы ошибок для новых соединений
+func (s *Settings) SetErrorPages(p *errorpage.Pages) {
+	s.errorPages.Store(p)
+}
+
+// Hosts - возвращает текущую таблицу виртуальных хостов, nil - виртуальные хосты не заданы
+func (s *Settings) Hosts() *vhost.Table {
+	return s.hosts.Load()
+}
+
+// SetHosts - заменяет таблицу виртуальных хостов для новых соединений
+func (s *Settings) SetHosts(t *vhost.Table) {
+	s.hosts.Store(t)
+}
+
+// StaticConfig - параметры отдачи файлов из RootPath с кешами и шаблоном сервера
+func (s *Settings) StaticConfig() static.Config {
+	return static.Config{
+		Root:           s.RootPath,
+		Listing:        true,
+		Template:       s.Template,
+		FileCache:      s.FileCache,
+		DirCache:       s.DirCache,
+		PerPage:        s.PerPage,
+		ArchiveMaxSize: s.ArchiveMaxSize,
+		Markdown:       s.RenderMarkdown && s.Markdown != nil,
+		MarkdownPages:  s.Markdown,
+		SSI:            s.SSI,
+	}
+}
+
 // Connection - структура с данными обрабатываемого соединения
 type Connection struct {
-	conn     *net.TCPConn
-	rootPath string
-	template *template.Template
+	conn net.Conn
+	// log - логер с данными обрабатываемого запроса
+	log *log.Logger
+	// w - writer для отправки ответа клиенту, с учетом ограничения скорости
+	w io.Writer
+	// sent - считает байты, отправленные клиенту
+	sent *countingWriter
+	// requestID - идентификатор запроса, которым помечаются все строки лога запроса
+	requestID string
+	// query - данные запроса, nil - запрос еще не распарсен
+	query *querydata.QueryData
+	// данные ответа для журнала запросов
+	status      int
+	headerBytes int64
+	user        string
+	accessLog   *accesslog.Logger
+	metrics     *metrics.Metrics
+	handler     handler.Handler
+	router      *location.Router
+	rewrites    *rewrite.Rules
+	root        string
+	errorPages  *errorpage.Pages
+	hosts       *vhost.Table
+	auth        *auth.Auth
+	acl         *acl.ACL
+	realIP      *realip.Resolver
+	limiter     *ratelimit.Limiter
+	throttle    *throttle.Throttle
+	// данные для страницы состояния
+	registry *Registry
+	id       uint64
+	state    connState
 }
 
 // New - создать структуру с данными обрабатываемого соединения
-func New(conn *net.TCPConn, rootPath string, template *template.Template) *Connection {
+func New(conn net.Conn, settings *Settings) *Connection {
+	sent := &countingWriter{w: conn}
+
+	h := settings.Handler
+	if h == nil {
+		h = static.New(settings.StaticConfig())
+	}
+
 	return &Connection{
-		conn:     conn,
-		rootPath: rootPath,
-		template: template,
+		conn:       conn,
+		log:        log.Default(),
+		w:          sent,
+		sent:       sent,
+		accessLog:  settings.AccessLog,
+		metrics:    settings.Metrics,
+		registry:   settings.Registry,
+		handler:    h,
+		router:     settings.Router(),
+		rewrites:   settings.Rewrites(),
+		errorPages: settings.ErrorPages(),
+		root:       settings.RootPath,
+		hosts:      settings.Hosts(),
+		auth:       settings.Auth,
+		acl:        settings.ACL,
+		realIP:     settings.RealIP,
+		limiter:    settings.Limiter,
+		throttle:   settings.Throttle,
 	}
 }
 
 // ProcessingConn - обрабатываем клиентское соединение
 func (c *Connection) ProcessingConn() {
+	start := time.Now()
+
+	// идентификатор нужен уже при чтении запроса; от доверенного прокси его можно получить позже
+	c.setRequestID(requestid.New())
+
+	// соединение видно на странице состояния, пока обрабатывается
+	c.setState(StateReading, nil)
+
+	if c.registry != nil {
+		c.registry.add(c)
+		defer c.registry.remove(c.id)
+	}
+
 	// получить данные запроса
 	data, err := c.readConn()
 	if err != nil {
 		// по возвращении клиентским сокетом EOF или другой ошибки логируем ошибку,
 		// так как не успели вычитать все данные, а клиент уже закрыл сокет
-		log.Errorf(err)
+		// (или соединение не прошло разбор заголовка PROXY protocol)
+		c.log.Errorf("%v", err)
+		c.close(c.conn, "")
 
 		return
 	}
@@ -54,54 +252,320 @@ func (c *Connection) ProcessingConn() {
 	if err != nil {
 		// некорректный запрос
 		if errors.Is(err, querydata.ErrInvalidHTTPReq) {
-			err = c.sendResponseHeader(&types.StatusData{
+			err = c.sendError(&types.StatusData{
 				Code: consts.StatusBadRequest,
 			}, err)
 		}
 
-		log.Errorf(err)
+		c.log.Errorf("%v", err)
+		c.complete(nil, start)
+		c.close(c.conn, "")
 
 		return
 	}
 
-	// закрыть клиентское соединение
-	if query.Header("X-Forwarded-For") != "" {
-		defer Close(c.conn, fmt.Sprintf("клиентское соединение %s закрыто", query.Header("X-Forwarded-For")))
-	} else {
-		defer Close(c.conn, fmt.Sprintf("клиентское соединение %s закрыто", c.conn.RemoteAddr().String()))
+	c.query = query
+
+	// определяем адрес клиента: заголовкам X-Forwarded-* и Forwarded верим только от доверенных прокси
+	query.SetClient(c.realIP.Resolve(c.conn.RemoteAddr(), query))
+
+	// идентификатор запроса, назначенный доверенным прокси, сохраняем для сквозного поиска по логам
+	if id := query.Header(requestid.Header); requestid.Valid(id) && c.realIP.Trusted(peerIP(c.conn)) {
+		c.setRequestID(id)
 	}
 
+	c.setState(StateProcessing, query)
+
+	// выбираем виртуальный хост: у него свои файлы, location и логи
+	host, unknownHost := c.selectHost(query)
+
+	// все строки лога запроса содержат идентификатор, данные клиента и запроса
+	c.log = c.log.With("client", query.Client().Addr, "method", query.Method(), "path", query.Path())
+
+	// закрыть клиентское соединение
+	defer c.close(c.conn, fmt.Sprintf("клиентское соединение %s закрыто", query.Client().Addr))
+
 	// логируем клиентские заголовки
-	logsReqHeaders(c.conn, query)
+	c.logsReqHeaders(query)
 
-	// работаем с путем до файла, взятым из строки запроса
-	path := filepath.Join(c.rootPath, query.Path())
+	// ограничиваем скорость отдачи ответа клиенту
+	if c.throttle != nil {
+		var release func()
 
-	// открываем запрашиваемый файл
-	f, fi, err := c.openFile(path)
-	if err != nil {
-		log.Errorf(err)
+		c.w, release = c.throttle.Writer(c.sent, query.Client().IP)
+		defer release()
+	}
+
+	// после отправки ответа пишем запрос в журнал и учитываем в счетчиках
+	defer c.complete(query, start)
+
+	// запрос к хосту, который сервер не обслуживает
+	if host == nil && unknownHost != 0 {
+		err = c.sendError(&types.StatusData{
+			Code: unknownHost,
+		}, fmt.Errorf("неизвестный хост %q", query.Client().Host))
+		c.log.Errorf("%v", err)
 
 		return
 	}
 
-	// закрыть файл
-	defer Close(f, "")
+	// проверяем ограничение частоты запросов клиента
+	if err = c.checkRate(query); err != nil {
+		c.log.Errorf("%v", err)
 
-	log.Infof("определен путь до файла: %q", path)
+		return
+	}
 
-	// если файл - каталог, выводим его содержимое
-	if fi.IsDir() {
-		c.workingWithCatalog(query.Path())
+	// применяем правила перезаписи до проверки доступа и выбора location
+	if redirected := c.rewrite(query); redirected {
+		return
+	}
+
+	// проверяем, разрешен ли доступ к пути с адреса клиента
+	if err = c.checkAccess(query); err != nil {
+		c.log.Errorf("%v", err)
 
 		return
 	}
 
-	// отправить клиенту заголовки и файл
-	err = c.SendFile(f, fi)
+	// проверяем учетные данные клиента до обращения к файлу
+	if err = c.authenticate(query, c.auth); err != nil {
+		c.log.Errorf("%v", err)
+
+		return
+	}
+
+	// выбираем location по пути запроса до обращения к файлам
+	h := c.handler
+
+	if loc := c.router.Match(query.Path()); loc != nil {
+		c.log.Infof("запрос обрабатывается location %q", loc)
+
+		// ответы location, включая отказ в аутентификации, используют ее страницы ошибок
+		c.errorPages = loc.ErrorPages()
+
+		if err = c.authenticate(query, loc.Auth()); err != nil {
+			c.log.Errorf("%v", err)
+
+			return
+		}
+
+		h = loc.Handler()
+	}
+
+	// передаем запрос обработчику
+	c.serve(query, h)
+}
+
+// выбрать виртуальный хост по заголовку Host и переключиться на его обработчики и логи;
+// если хост неизвестен, возвращается nil и статус ответа клиенту
+func (c *Connection) selectHost(query *querydata.QueryData) (*vhost.Host, int) {
+	if c.hosts == nil {
+		return nil, 0
+	}
+
+	host, status := c.hosts.Match(query.Client().Host)
+	if host == nil {
+		return nil, status
+	}
+
+	c.handler = host.Handler()
+	c.router = host.Router()
+	c.rewrites = host.Rewrites()
+	c.errorPages = host.ErrorPages()
+	c.root = host.Root()
+
+	if l := host.Log(); l != nil {
+		c.log = l.With("request_id", c.requestID, "host", host.String())
+	} else {
+		c.log = c.log.With("host", host.String())
+	}
+
+	if al := host.AccessLog(); al != nil {
+		c.accessLog = al
+	}
+
+	return host, 0
+}
+
+// применить правила перезаписи: внутренняя перезапись меняет путь запроса,
+// перенаправление сразу отправляется клиенту; возвращает true, если клиент перенаправлен
+func (c *Connection) rewrite(query *querydata.QueryData) bool {
+	res, ok := c.rewrites.Apply(query.Method(), query.Client().Host, query.Path(), query.RawQuery(), c.root)
+	if !ok {
+		return false
+	}
+
+	if res.Redirect != "" {
+		err := c.sendResponseHeader(&types.StatusData{
+			Code:    res.Code,
+			Headers: []types.Header{{Name: "Location", Value: res.Redirect}},
+		}, nil)
+		if err != nil {
+			c.log.Errorf("%v", err)
+		}
+
+		c.log.Infof("клиент перенаправлен на %q", res.Redirect)
+
+		return true
+	}
+
+	c.log.Infof("путь запроса перезаписан на %q", res.Path)
+	query.Rewrite(res.Path, res.RawQuery)
+
+	return false
+}
+
+// передать запрос обработчику h и завершить ответ
+func (c *Connection) serve(query *querydata.QueryData, h handler.Handler) {
+	resp := newResponse(c, query.Method())
+
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		// обработчик прервал передачу ответа: завершающий блок не отправляем, соединение будет закрыто
+		if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			return
+		}
+
+		c.log.Errorf("паника в обработчике запроса: %v\n%s", v, debug.Stack())
+
+		// если заголовки еще не отправлены, клиент получит 500
+		if !resp.sent {
+			if err := c.sendInternalServerError(nil); err != nil {
+				c.log.Errorf("%v", err)
+			}
+		}
+	}()
+
+	req := handler.NewRequest(query, c.body(query), c.log, c.requestID, c.user)
+	req.SetIncludeCheck(c.includeCheck(query))
+
+	h.ServeHTTP(resp, req)
+
+	if err := resp.finish(); err != nil {
+		c.log.Errorf("ответ не был отправлен клиенту: %v", err)
+	}
+}
+
+// тело запроса: данные, прочитанные вместе с заголовками, и остаток из сокета до Content-Length
+func (c *Connection) body(query *querydata.QueryData) io.Reader {
+	length, err := strconv.ParseInt(query.Header("Content-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return bytes.NewReader(nil)
+	}
+
+	prefix := query.Body()
+	if int64(len(prefix)) >= length {
+		return bytes.NewReader(prefix[:length])
+	}
+
+	return io.MultiReader(bytes.NewReader(prefix), io.LimitReader(c.conn, length-int64(len(prefix))))
+}
+
+// проверить ограничение частоты запросов клиента; при превышении отправить клиенту 429
+func (c *Connection) checkRate(query *querydata.QueryData) error {
+	if c.limiter == nil {
+		return nil
+	}
+
+	allowed, wait := c.limiter.Allow(query.Client().IP)
+	if !allowed {
+		return c.sendError(&types.StatusData{
+			Code:    consts.StatusTooManyRequests,
+			Headers: []types.Header{RetryAfter(wait)},
+		}, fmt.Errorf("клиент %s превысил ограничение частоты запросов", query.Client().Addr))
+	}
+
+	return nil
+}
+
+// RetryAfter - заголовок Retry-After с временем ожидания в целых секундах, не меньше секунды
+func RetryAfter(wait time.Duration) types.Header {
+	seconds := max(int64(math.Ceil(wait.Seconds())), 1)
+
+	return types.Header{Name: "Retry-After", Value: strconv.FormatInt(seconds, 10)}
+}
+
+// Reject - отклонить соединение, не читая запрос: отправить клиенту статус и закрыть соединение
+func Reject(conn net.Conn, statusData *types.StatusData, mainError error) {
+	sent := &countingWriter{w: conn}
+	c := &Connection{conn: conn, log: log.Default(), w: sent, sent: sent}
+
+	log.Errorf(c.sendResponseHeader(statusData, mainError))
+	Close(conn, "")
+}
+
+// проверить правила доступа по IP-адресу клиента; при запрете отправить клиенту 403
+func (c *Connection) checkAccess(query *querydata.QueryData) error {
+	if c.acl == nil {
+		return nil
+	}
+
+	ip := query.Client().IP
+
+	allowed, reason := c.acl.Allowed(query.Path(), ip)
+	if !allowed {
+		return c.sendError(&types.StatusData{
+			Code: consts.StatusForbidden,
+		}, fmt.Errorf("доступ к %q с адреса %v запрещен: %s", query.Path(), ip, reason))
+	}
+
+	c.log.Infof("доступ к %q с адреса %v разрешен: %s", query.Path(), ip, reason)
+
+	return nil
+}
+
+// проверка путей, которые обработчик включает в ответ без отдельного запроса: путь должен обслуживаться
+// той же location, что и запрос, быть доступен с адреса клиента и защищен теми же учетными данными
+func (c *Connection) includeCheck(query *querydata.QueryData) func(string) error {
+	page := query.Path()
+	loc := c.router.Match(page)
+
+	return func(urlPath string) error {
+		if c.router.Match(urlPath) != loc {
+			return fmt.Errorf("путь %q обслуживается другой location", urlPath)
+		}
+
+		if c.acl != nil {
+			ip := query.Client().IP
+
+			if allowed, reason := c.acl.Allowed(urlPath, ip); !allowed {
+				return fmt.Errorf("доступ к %q с адреса %v запрещен: %s", urlPath, ip, reason)
+			}
+		}
+
+		if !c.auth.SameRule(page, urlPath) || (loc != nil && !loc.Auth().SameRule(page, urlPath)) {
+			return fmt.Errorf("путь %q защищен другими правилами аутентификации", urlPath)
+		}
+
+		return nil
+	}
+}
+
+// проверить учетные данные клиента, если путь защищен; при отказе отправить клиенту 401
+func (c *Connection) authenticate(query *querydata.QueryData, a *auth.Auth) error {
+	if a == nil {
+		return nil
+	}
+
+	user, challenge, err := a.Check(query.Method(), query.Path(), query.RequestURI(), query.Header("Authorization"))
 	if err != nil {
-		log.Errorf(err)
+		return c.sendError(&types.StatusData{
+			Code:    consts.StatusUnauthorized,
+			Headers: []types.Header{{Name: "WWW-Authenticate", Value: challenge}},
+		}, fmt.Errorf("доступ к %q запрещен: %w", query.Path(), err))
+	}
+
+	if user != "" {
+		c.user = user
+		c.log.Infof("пользователь %q прошел аутентификацию", user)
 	}
+
+	return nil
 }
 
 // прочитать из клиентского сокета данные в буфер
@@ -134,126 +598,210 @@ func (c *Connection) readConn() ([]byte, error) {
 	return data, nil
 }
 
-// SendFile - отправить клиенту заголовки и файл
-func (c *Connection) SendFile(f *os.File, fi os.FileInfo) error {
-	// отправляем клиенту заголовки
-	err := c.sendResponseHeader(&types.StatusData{
-		Code: consts.StatusOK,
-		Size: fi.Size(),
-		Name: fi.Name(),
-	}, nil)
-	if err != nil {
-		log.Errorf(err)
+// отправляем заголоки с ошибкой 500
+func (c *Connection) sendInternalServerError(mainError error) error {
+	err := c.sendError(&types.StatusData{
+		Code: consts.StatusInternalServerError,
+	}, mainError)
+
+	return err
+}
+
+// отправляем клиенту заголовки ответа с ошибкой и страницу ошибки
+func (c *Connection) sendError(statusData *types.StatusData, mainError error) error {
+	contentType, body := c.errorPage(statusData.Code)
+
+	statusData.ContentType = contentType
+	statusData.Size = int64(len(body))
+
+	if err := c.sendResponseHeader(statusData, nil); err != nil {
+		return fmt.Errorf("%w: %w", err, mainError)
+	}
 
-		return err
+	// на HEAD отправляем только заголовки
+	if c.query != nil && c.query.Method() == http.MethodHead {
+		return mainError
 	}
-	// отправить файл клиенту
-	if err = file.Send(c.conn, f); err != nil {
-		return fmt.Errorf("файл не был отправлен клиенту: %w", err)
+
+	if _, err := c.w.Write(body); err != nil {
+		return errors.Join(mainError, fmt.Errorf("не удалось отправить страницу ошибки: %w", err))
 	}
 
-	return nil
+	return mainError
 }
 
-// работаем с каталогом
-func (c *Connection) workingWithCatalog(queryPath string) {
-	log.Infof("файл %q: is a directory", filepath.Join(c.rootPath, queryPath))
+// страница ошибки для статуса code в формате, который предпочитает клиент
+func (c *Connection) errorPage(code int) (string, []byte) {
+	data := errorpage.Data{Status: code, RequestID: c.requestID}
 
-	// выводим содержимое каталога
-	buf, err := dir.ShowDir(c.rootPath, queryPath, c.template)
-	if err != nil {
-		// содержимое каталога не готово к отправке - 500
-		err = c.sendInternalServerError(err)
-		log.Errorf("содержимое каталога %q не готово к отправке: %v", filepath.Join(c.rootPath, queryPath), err)
+	var accept string
 
-		return
+	if c.query != nil {
+		data.Method = c.query.Method()
+		data.Path = c.query.OriginalPath()
+		data.Host = c.query.Client().Host
+		accept = c.query.Header("Accept")
 	}
-	// отправляем заголовки
-	err = c.sendResponseHeader(&types.StatusData{
-		Code:        consts.StatusOK,
-		Size:        int64(buf.Len()),
-		ContentType: "text/html"}, nil)
 
+	contentType, body, err := c.errorPages.Render(accept, data)
 	if err != nil {
-		log.Errorf("не удалось отправить заголовки: %v", err)
+		c.log.Errorf("%v", err)
+	}
 
-		return
+	return contentType, body
+}
+
+// отправляем клиенту заголовки ответа
+func (c *Connection) sendResponseHeader(statusData *types.StatusData, mainError error) error {
+	// клиент получает идентификатор запроса, чтобы сообщить его при обращении в поддержку
+	if c.requestID != "" {
+		statusData.Headers = append(statusData.Headers, types.Header{Name: requestid.Header, Value: c.requestID})
 	}
-	// записать содержимое буфера в клиентский сокет
-	_, err = c.conn.Write(buf.Bytes())
+
+	// формируем данные для ответа
+	data := headerdata.HeaderData{}
+	data.SetResponseData(statusData)
+
+	c.status = statusData.Code
+	c.setState(StateSending, nil)
+
+	// отправляем заголовки клиенту
+	err := data.WriteResponseHeader(c.w, c.log)
+
+	c.headerBytes = c.sent.n.Load()
+
 	if err != nil {
-		log.Errorf("содержимое каталога %q не готово к отправке: %v", filepath.Join(c.rootPath, queryPath), err)
+		return fmt.Errorf("%w: %w", err, mainError)
+	}
 
-		return
+	return mainError
+}
+
+// учесть завершенный запрос; query - nil, если запрос не удалось распарсить
+func (c *Connection) complete(query *querydata.QueryData, start time.Time) {
+	if c.metrics != nil {
+		var method string
+		if query != nil {
+			method = query.Method()
+		}
+
+		c.metrics.ObserveRequest(method, c.status, c.sent.n.Load()-c.headerBytes, time.Since(start))
 	}
 
-	log.Infof("клиенту отправлен html файл с содержимым каталога %q", filepath.Join(c.rootPath, queryPath))
+	c.logAccess(query, start)
 }
 
-// получаем дескриптор открытого файла
-func (c *Connection) openFile(path string) (*os.File, os.FileInfo, error) {
-	var respdata *types.StatusData
+// записать завершенный запрос в журнал запросов; query - nil, если запрос не удалось распарсить
+func (c *Connection) logAccess(query *querydata.QueryData, start time.Time) {
+	if c.accessLog == nil {
+		return
+	}
 
-	file, err := file.Open(path)
-	if err != nil {
-		switch {
-		// файл должен быть, иначе 404
-		case errors.Is(err, fs.ErrNotExist):
-			// создаем ответ сервера для клиента: файл не найден
-			respdata = &types.StatusData{
-				Code: consts.StatusNotFound,
-			}
-		// файл должен быть доступен, иначе 403
-		case errors.Is(err, fs.ErrPermission):
-			// создаем ответ сервера для клиента: доступ к файлу запрещен
-			respdata = &types.StatusData{
-				Code: consts.StatusForbidden,
-			}
-		// файл не был открыт - 500
-		default:
-			// создаем ответ сервера для клиента: ошибка со стороны сервера
-			respdata = &types.StatusData{
-				Code: consts.StatusInternalServerError,
-			}
+	// в журнал пишем адрес клиента без порта
+	client := c.conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	e := &accesslog.Entry{
+		Client:    client,
+		User:      c.user,
+		RequestID: c.requestID,
+		Start:     start,
+		Duration:  time.Since(start),
+		Status:    c.status,
+		// в журнал попадает размер тела ответа без заголовков
+		Bytes: c.sent.n.Load() - c.headerBytes,
+	}
+
+	if query != nil {
+		if ip := query.Client().IP; ip != nil {
+			e.Client = ip.String()
+		} else {
+			e.Client = query.Client().Addr
 		}
-		// отправляем клиенту: ошибка при открытии файла
-		err = c.sendResponseHeader(respdata, err)
 
-		return nil, nil, err
+		e.Method = query.Method()
+		e.Target = query.RequestURI()
+		// в журнал попадает запрос клиента, а не результат перезаписи
+		e.Path = query.OriginalPath()
+		e.Query = query.OriginalRawQuery()
+		e.Protocol = query.Protocol()
+		e.Header = query.Header
 	}
-	// получить информацию о файле
-	fi, err := file.Stat()
-	if err != nil {
-		// файл не отправлен - 500
-		err = c.sendInternalServerError(err)
 
-		return nil, nil, err
+	if err := c.accessLog.Log(e); err != nil {
+		c.log.Errorf("запрос не записан в журнал запросов: %v", err)
 	}
+}
 
-	return file, fi, nil
+// назначить идентификатор запроса и добавить его в строки лога
+func (c *Connection) setRequestID(id string) {
+	c.requestID = id
+	c.log = log.With("request_id", id)
+
+	c.state.mu.Lock()
+	c.state.requestID = id
+	c.state.mu.Unlock()
 }
 
-// отправляем заголоки с ошибкой 500
-func (c *Connection) sendInternalServerError(mainError error) error {
-	err := c.sendResponseHeader(&types.StatusData{
-		Code: consts.StatusInternalServerError,
-	}, mainError)
+// адрес, с которого установлено соединение
+func peerIP(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
 
-	return err
+	return nil
 }
 
-// отправляем клиенту заголовки ответа
-func (c *Connection) sendResponseHeader(statusData *types.StatusData, mainError error) error {
-	// формируем данные для ответа
-	data := headerdata.HeaderData{}
-	data.SetResponseData(statusData)
+// обновить данные соединения для страницы состояния; query - nil, если данные запроса не меняются
+func (c *Connection) setState(state string, query *querydata.QueryData) {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
 
-	// отправляем заголовки клиенту
-	if err := data.WriteResponseHeader(c.conn); err != nil {
-		return fmt.Errorf("%w: %w", err, mainError)
+	if c.state.started.IsZero() {
+		c.state.started = time.Now()
+		c.state.client = c.conn.RemoteAddr().String()
 	}
 
-	return mainError
+	c.state.state = state
+
+	if query != nil {
+		c.state.client = query.Client().Addr
+		c.state.method = query.Method()
+		c.state.path = query.Path()
+	}
+}
+
+// данные соединения для страницы состояния
+func (c *Connection) info() Info {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+
+	return Info{
+		ID:        c.id,
+		RequestID: c.state.requestID,
+		Client:    c.state.client,
+		Method:    c.state.method,
+		Path:      c.state.path,
+		BytesSent: c.sent.n.Load(),
+		Started:   c.state.started,
+		Age:       time.Since(c.state.started).Round(time.Millisecond).String(),
+		State:     c.state.state,
+	}
+}
+
+// countingWriter - writer, считающий отправленные байты
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+
+	return n, err
 }
 
 // Close - закрытие файла или соединения
@@ -266,28 +814,35 @@ func Close(c io.Closer, m string) {
 	}
 
 	if m != "" {
-		log.Infof(m)
+		log.Infof("%s", m)
 	}
 }
 
-// залогировать начало работы с клиентским соединением с учетом заголовков запроса
-func logsReqHeaders(conn *net.TCPConn, query *querydata.QueryData) {
-	cliSocket := query.Header("X-Forwarded-For")
-	if cliSocket == "" {
-		cliSocket = conn.RemoteAddr().String()
+// закрытие файла или соединения с записью в лог запроса
+func (c *Connection) close(cl io.Closer, m string) {
+	if err := cl.Close(); err != nil {
+		c.log.Errorf("%v", err)
+
+		return
 	}
 
-	host := query.Header("X-Forwarded-Host")
-	if host == "" {
-		host = query.Header("Host")
+	if m != "" {
+		c.log.Infof("%s", m)
 	}
+}
+
+// залогировать начало работы с клиентским соединением с учетом заголовков запроса
+func (c *Connection) logsReqHeaders(query *querydata.QueryData) {
+	client := query.Client()
+	cliSocket := client.Addr
+	host := client.Host
 
-	log.Infof("начинается работа с клиентским сокетом %s", cliSocket)
+	c.log.Infof("начинается работа с клиентским сокетом %s", cliSocket)
 
 	// логируем клиентские заголовки
-	log.Infof("распарсили данные, поступившие от клиента:")
+	c.log.Infof("распарсили данные, поступившие от клиента:")
 
-	log.Infof("\"%v %v %v\" %v %v \"%v\"\n",
+	c.log.Infof("\"%v %v %v\" %v %v \"%v\"\n",
 		query.Method(), query.Path(), query.Protocol(), cliSocket,
 		host, query.Header("User-Agent"))
 }
@@ -4,14 +4,30 @@ package consts
 const (
 	// StatusOK - статус ответа: хорошо
 	StatusOK = 200
+	// StatusFound - статус ответа: ресурс временно перемещен
+	StatusFound = 302
 	// StatusBadRequest - статус ответа: некорректный запрос
 	StatusBadRequest = 400
+	// StatusUnauthorized - статус ответа: требуется аутентификация
+	StatusUnauthorized = 401
 	// StatusForbidden - статус ответа: запрещено
 	StatusForbidden = 403
 	// StatusNotFound - статус ответа: не найдено
 	StatusNotFound = 404
+	// StatusLengthRequired - статус ответа: тело запроса без заголовка Content-Length не принимается
+	StatusLengthRequired = 411
+	// StatusMisdirectedRequest - статус ответа: запрос направлен серверу, который не обслуживает этот хост
+	StatusMisdirectedRequest = 421
+	// StatusTooManyRequests - статус ответа: слишком много запросов
+	StatusTooManyRequests = 429
 	// StatusInternalServerError - статус ответа: внутренняя ошибка сервера
 	StatusInternalServerError = 500
+	// StatusBadGateway - статус ответа: вышестоящий сервер недоступен или ответил некорректно
+	StatusBadGateway = 502
+	// StatusGatewayTimeout - статус ответа: вышестоящий сервер не ответил вовремя
+	StatusGatewayTimeout = 504
 	// BufSize - дефолтный размер буфера
 	BufSize = 4096
+	// MaxPerPage - максимальное количество файлов на странице со списком файлов каталога
+	MaxPerPage = 5000
 )
@@ -25,15 +25,15 @@ func (r *responseHeaders) Add(headerName, headerValue string) {
 }
 
 // сформировать буфер с заголовками
-func (r *responseHeaders) ToBytes() []byte {
+func (r *responseHeaders) ToBytes(l *log.Logger) []byte {
 	var headers bytes.Buffer
 	for _, v := range *r {
 		_, err := headers.WriteString(v + "\n")
 		if err != nil {
-			log.Errorf("заголовок %q не был записан в буфер: %v", v, err)
+			l.Errorf("заголовок %q не был записан в буфер: %v", v, err)
 		}
 
-		log.Infof(v)
+		l.Debugf("%s", v)
 	}
 
 	headers.WriteByte('\n')
@@ -60,11 +60,13 @@ func (h *HeaderData) SetResponseData(data *types.StatusData) {
 		Size:        strconv.FormatInt(data.Size, 10),
 		Name:        data.Name,
 		ContentType: data.ContentType,
+		Chunked:     data.Chunked,
+		Headers:     data.Headers,
 	}
 }
 
-// WriteResponseHeader - формируем и отправляем клиенту заголовки ответа
-func (h *HeaderData) WriteResponseHeader(w io.Writer) error {
+// WriteResponseHeader - формируем и отправляем клиенту заголовки ответа; l - логер запроса
+func (h *HeaderData) WriteResponseHeader(w io.Writer, l *log.Logger) error {
 	respStatus := types.ResponseStatusLine{
 		Version: "HTTP/1.1",
 		Status:  h.responseData.Status,
@@ -76,45 +78,78 @@ func (h *HeaderData) WriteResponseHeader(w io.Writer) error {
 	respHeaders.Add("Connection", "close")
 	respHeaders.Add("Date", time.Now().Format(time.UnixDate))
 
-	if h.responseData.Size != "" {
+	// при передаче тела частями размер заранее неизвестен
+	if h.responseData.Chunked {
+		respHeaders.Add("Transfer-Encoding", "chunked")
+	} else if h.responseData.Size != "" {
 		respHeaders.Add("Size", h.responseData.Size)
 	}
+
+	for _, v := range h.responseData.Headers {
+		// перевод строки в значении позволил бы клиенту дописать в ответ свои заголовки
+		if !validHeader(v.Name, v.Value) {
+			l.Errorf("заголовок %q не отправлен: недопустимые символы в имени или значении", v.Name)
+
+			continue
+		}
+
+		respHeaders.Add(v.Name, v.Value)
+	}
+	// явно заданный тип пишем всегда
+	if h.responseData.ContentType != "" && validHeader("Content-Type", h.responseData.ContentType) {
+		respHeaders.Add("Content-Type", h.responseData.ContentType)
+
+		return writeToConn(w, l, respStatus, respHeaders)
+	}
 	// не пишем Content-Type, если ошибка
 	if h.responseData.Status != strconv.Itoa(consts.StatusOK) {
-		return writeToConn(w, respStatus, respHeaders)
+		return writeToConn(w, l, respStatus, respHeaders)
 	}
 
-	if h.responseData.ContentType != "" {
-		respHeaders.Add("Content-Type", h.responseData.ContentType)
+	respHeaders.Add("Content-Type", ContentType(h.responseData.Name))
 
-		return writeToConn(w, respStatus, respHeaders)
-	}
+	// пишем ответ в клиентский сокет
+	return writeToConn(w, l, respStatus, respHeaders)
+}
 
-	// если у файла в названии есть расширение, пишем тип файла в заголовок Content-Type
-	extIndex := strings.LastIndex(h.responseData.Name, ".")
+// ContentType - тип файла по расширению в имени, если расширения нет или оно неизвестно - application/octet-stream
+func ContentType(name string) string {
+	extIndex := strings.LastIndex(name, ".")
 	if extIndex == -1 {
-		respHeaders.Add("Content-Type", "application/octet-stream")
-		// пишем ответ в клиентский сокет
-		return writeToConn(w, respStatus, respHeaders)
+		return "application/octet-stream"
 	}
 
-	contentType := mime.TypeByExtension(h.responseData.Name[extIndex:])
-
+	contentType := mime.TypeByExtension(name[extIndex:])
 	if contentType == "" {
-		respHeaders.Add("Content-Type", "application/octet-stream")
+		return "application/octet-stream"
+	}
 
-		// пишем ответ в клиентский сокет
-		return writeToConn(w, respStatus, respHeaders)
+	return contentType
+}
+
+// в имени заголовка нет управляющих символов, пробелов и ':', в значении - управляющих символов, кроме табуляции
+func validHeader(name, value string) bool {
+	if name == "" || strings.ContainsAny(name, " \t:") {
+		return false
 	}
 
-	respHeaders.Add("Content-Type", contentType)
+	for _, c := range []byte(name) {
+		if c < ' ' || c == 0x7f {
+			return false
+		}
+	}
 
-	// пишем ответ в клиентский сокет
-	return writeToConn(w, respStatus, respHeaders)
+	for _, c := range []byte(value) {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
 }
 
 // пишем заголовки в клиентский сокет
-func writeToConn(w io.Writer, respStatus types.ResponseStatusLine, respHeaders responseHeaders) error {
+func writeToConn(w io.Writer, l *log.Logger, respStatus types.ResponseStatusLine, respHeaders responseHeaders) error {
 	// сформировать статусную строку
 	var statusString = respStatus.Version + " " + respStatus.Status + " " + respStatus.Phrase + "\n"
 
@@ -124,20 +159,20 @@ func writeToConn(w io.Writer, respStatus types.ResponseStatusLine, respHeaders r
 		return fmt.Errorf("строка статуса не была записана в сокет: %w", err)
 	}
 
-	log.Infof("---")
-	log.Infof("%s", statusString)
+	l.Debugf("---")
+	l.Infof("%s", statusString)
 
 	// сформировать буфер с заголовками ответа
-	headers := respHeaders.ToBytes()
+	headers := respHeaders.ToBytes(l)
 
-	log.Infof("---")
+	l.Debugf("---")
 	// записать в клиентский сокет заголовки ответа
 	_, err = w.Write(headers)
 	if err != nil {
 		return fmt.Errorf("заголовки не были записаны в сокет: %w", err)
 	}
 
-	log.Infof("клиенту отправлены заголовки ответа")
+	l.Infof("клиенту отправлены заголовки ответа")
 
 	return nil
 }
@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnknownConn - соединение с указанным идентификатором не найдено
+var ErrUnknownConn = errors.New("соединение не найдено")
+
+// состояния обрабатываемого соединения
+const (
+	// StateReading - читаем запрос клиента
+	StateReading = "reading"
+	// StateProcessing - запрос прочитан, готовим ответ
+	StateProcessing = "processing"
+	// StateSending - отправляем ответ
+	StateSending = "sending"
+)
+
+// Info - данные открытого соединения для страницы состояния
+type Info struct {
+	ID        uint64    `json:"id"`
+	RequestID string    `json:"request_id"`
+	Client    string    `json:"client"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	BytesSent int64     `json:"bytes_sent"`
+	Started   time.Time `json:"started"`
+	Age       string    `json:"age"`
+	State     string    `json:"state"`
+}
+
+// данные соединения, которые меняются во время обработки и читаются со страницы состояния
+type connState struct {
+	mu        sync.Mutex
+	requestID string
+	client    string
+	method    string
+	path      string
+	state     string
+	started   time.Time
+}
+
+// Registry - список открытых соединений
+type Registry struct {
+	lastID atomic.Uint64
+
+	mu    sync.Mutex
+	conns map[uint64]*Connection
+}
+
+// NewRegistry - создать список открытых соединений
+func NewRegistry() *Registry {
+	return &Registry{
+		conns: make(map[uint64]*Connection),
+	}
+}
+
+// добавить соединение в список; идентификатор присваивается под блокировкой,
+// чтобы List в другой горутине видел его вместе с соединением
+func (r *Registry) add(c *Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.id = r.lastID.Add(1)
+	r.conns[c.id] = c
+}
+
+// удалить соединение из списка
+func (r *Registry) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.conns, id)
+}
+
+// List - возвращает данные открытых соединений, упорядоченные по идентификатору
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	conns := make([]*Connection, 0, len(r.conns))
+
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+
+	list := make([]Info, 0, len(conns))
+
+	for _, c := range conns {
+		list = append(list, c.info())
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Close - принудительно закрыть соединение: обработка прервется на ближайшем чтении или записи
+func (r *Registry) Close(id uint64) error {
+	r.mu.Lock()
+	c, ok := r.conns[id]
+	r.mu.Unlock()
+
+	if !ok {
+		return ErrUnknownConn
+	}
+
+	return c.conn.Close()
+}
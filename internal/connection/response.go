@@ -0,0 +1,174 @@
+package connection
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/connection/types"
+)
+
+// ErrBodyNotAllowed - попытка отправить тело в ответе, который не может его содержать
+var ErrBodyNotAllowed = errors.New("ответ с этим статусом или на этот метод не может содержать тело")
+
+// response - запись ответа обработчика в клиентское соединение
+type response struct {
+	c      *Connection
+	header http.Header
+	code   int
+	// заголовки уже отправлены
+	sent bool
+	// тело не отправляется: ответ на HEAD или статус без тела
+	noBody bool
+	head   bool
+	// chunked - writer для передачи тела частями, nil - размер тела известен
+	chunked io.WriteCloser
+	err     error
+}
+
+// newResponse - запись ответа на запрос с методом method
+func newResponse(c *Connection, method string) *response {
+	return &response{
+		c:      c,
+		head:   method == http.MethodHead,
+		header: make(http.Header),
+	}
+}
+
+// Header - заголовки ответа
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader - запомнить статус ответа; заголовки отправятся с первой частью тела
+func (r *response) WriteHeader(code int) {
+	if r.sent || r.code != 0 {
+		return
+	}
+
+	r.code = code
+}
+
+// Write - отправить часть тела ответа
+func (r *response) Write(p []byte) (int, error) {
+	if !r.sent {
+		r.writeHeader(true)
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// тело ответа на HEAD молча отбрасываем, заголовки при этом остаются такими же, как для GET
+	if r.head {
+		return len(p), nil
+	}
+
+	if r.noBody {
+		return 0, ErrBodyNotAllowed
+	}
+
+	var (
+		n   int
+		err error
+	)
+
+	if r.chunked != nil {
+		n, err = r.chunked.Write(p)
+	} else {
+		n, err = r.c.w.Write(p)
+	}
+
+	// после ошибки записи соединение непригодно, завершающий блок не отправляем
+	r.err = err
+
+	return n, err
+}
+
+// отправить строку статуса и заголовки; hasBody - обработчик начал отправлять тело
+func (r *response) writeHeader(hasBody bool) {
+	r.sent = true
+
+	if r.code == 0 {
+		r.code = consts.StatusOK
+	}
+
+	r.noBody = r.head || !bodyAllowed(r.code)
+
+	statusData := &types.StatusData{
+		Code:        r.code,
+		ContentType: r.header.Get("Content-Type"),
+	}
+
+	// размер тела известен из Content-Length, иначе тело передаем частями;
+	// если тела нет, размер нулевой
+	if size, err := strconv.ParseInt(r.header.Get("Content-Length"), 10, 64); err == nil && size >= 0 {
+		statusData.Size = size
+	} else if hasBody && !r.noBody {
+		statusData.Chunked = true
+	}
+
+	names := make([]string, 0, len(r.header))
+	for name := range r.header {
+		if name != "Content-Type" && name != "Content-Length" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range r.header[name] {
+			statusData.Headers = append(statusData.Headers, types.Header{Name: name, Value: v})
+		}
+	}
+
+	if r.err = r.c.sendResponseHeader(statusData, nil); r.err != nil {
+		return
+	}
+
+	if statusData.Chunked {
+		r.chunked = httputil.NewChunkedWriter(r.c.w)
+	}
+}
+
+// завершить ответ: отправить заголовки, если тела не было, и завершающий блок тела, переданного частями
+func (r *response) finish() error {
+	// обработчик вернул ошибку без тела: клиент получит страницу ошибки
+	if !r.sent && r.code >= http.StatusBadRequest && r.header.Get("Content-Length") == "" {
+		contentType, body := r.c.errorPage(r.code)
+
+		r.header.Set("Content-Type", contentType)
+		r.header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		if _, err := r.Write(body); err != nil {
+			return err
+		}
+	}
+
+	if !r.sent {
+		r.writeHeader(false)
+	}
+
+	if r.err != nil || r.chunked == nil {
+		return r.err
+	}
+
+	// завершающий блок нулевой длины и пустой трейлер
+	if err := r.chunked.Close(); err != nil {
+		return err
+	}
+
+	_, err := r.c.w.Write([]byte("\r\n"))
+
+	return err
+}
+
+// может ли ответ с этим статусом содержать тело
+func bodyAllowed(code int) bool {
+	return code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -8,12 +8,21 @@ type ResponseStatusLine struct {
 	Phrase  string
 }
 
+// Header - дополнительный заголовок ответа
+type Header struct {
+	Name  string
+	Value string
+}
+
 // StatusData - собираемые данные для строки статуса и заголовков ответа
 type StatusData struct {
 	Code        int
 	Size        int64
 	Name        string
 	ContentType string
+	// Chunked - размер тела заранее неизвестен, тело передается частями
+	Chunked bool
+	Headers []Header
 }
 
 // ResponseData - сформированные данные для строки статуса и заголовков ответа
@@ -23,4 +32,6 @@ type ResponseData struct {
 	Size        string
 	Name        string
 	ContentType string
+	Chunked     bool
+	Headers     []Header
 }
@@ -0,0 +1,258 @@
+package dir
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/watch"
+)
+
+// максимальное количество отрисованных страниц, хранимых для одного каталога
+const maxRenderedPages = 16
+
+// ключ отрисованной страницы: путь запроса, шаблон и параметры постраничного вывода
+type pageKey struct {
+	urlPath  string
+	template *template.Template
+	page     Page
+}
+
+// закешированное содержимое каталога
+type listing struct {
+	names []string
+	// watched - каталог отслеживается наблюдателем, иначе актуальность проверяется по modTime
+	watched  bool
+	modTime  time.Time
+	lastUsed time.Time
+	rendered map[pageKey][]byte
+}
+
+// Cache - кеш содержимого каталогов и отрисованных страниц со списком файлов
+type Cache struct {
+	mu       sync.Mutex
+	listings map[string]*listing
+	maxDirs  int
+	// наблюдатель за изменениями каталогов, nil - изменения проверяются по времени изменения каталога;
+	// каталоги, которые не удалось начать отслеживать, тоже проверяются по времени изменения
+	watcher *watch.Watcher
+	// счетчик инвалидаций: если изменился во время чтения каталога, результат не кешируем
+	generation uint64
+}
+
+// NewCache - создать кеш содержимого не более чем maxDirs каталогов
+func NewCache(maxDirs int) *Cache {
+	c := &Cache{
+		listings: make(map[string]*listing),
+		maxDirs:  maxDirs,
+	}
+
+	// если inotify недоступен, будем сверять время изменения каталога при каждом запросе
+	w, err := watch.New(c.changed)
+	if err != nil {
+		log.Infof("кеш каталогов будет проверять время изменения каталогов: %v", err)
+
+		return c
+	}
+
+	c.watcher = w
+
+	return c
+}
+
+// ShowDir - отправляем клиенту содержимое каталога dirPath, запрошенного по пути urlPath, используя кеш
+func (c *Cache) ShowDir(dirPath, urlPath string, t *template.Template, page Page) (*bytes.Buffer, error) {
+	key := pageKey{urlPath: urlPath, template: t, page: page}
+
+	l, err := c.get(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	data, ok := l.rendered[key]
+	c.mu.Unlock()
+
+	if ok {
+		return bytes.NewBuffer(data), nil
+	}
+
+	buf, err := render(dirPath, urlPath, t, l.names, page)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// ограничиваем количество отрисованных страниц каталога
+	if len(l.rendered) >= maxRenderedPages {
+		clear(l.rendered)
+	}
+
+	l.rendered[key] = buf.Bytes()
+	c.mu.Unlock()
+
+	return buf, nil
+}
+
+// Invalidate - удалить содержимое каталога из кеша
+func (c *Cache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.remove(path)
+}
+
+// изменение от наблюдателя: путь каталога или "" - события потеряны, сбрасываем весь кеш
+func (c *Cache) changed(path string) {
+	if path == "" {
+		c.Purge()
+
+		return
+	}
+
+	c.Invalidate(path)
+}
+
+// получаем актуальное содержимое каталога из кеша или с диска
+func (c *Cache) get(path string) (*listing, error) {
+	c.mu.Lock()
+	l, ok := c.listings[path]
+
+	// изменения отслеживаемого каталога сбрасывают его из кеша
+	if ok && l.watched {
+		l.lastUsed = time.Now()
+		c.mu.Unlock()
+
+		return l, nil
+	}
+	c.mu.Unlock()
+
+	// каталог не отслеживается: сверяем время его изменения
+	fi, err := os.Stat(path)
+	if err != nil {
+		c.Invalidate(path)
+
+		return nil, err
+	}
+
+	modTime := fi.ModTime()
+
+	c.mu.Lock()
+	l, ok = c.listings[path]
+
+	if ok && !l.watched && l.modTime.Equal(modTime) {
+		l.lastUsed = time.Now()
+		c.mu.Unlock()
+
+		return l, nil
+	}
+
+	generation := c.generation
+	c.mu.Unlock()
+
+	// начинаем отслеживать каталог до чтения, чтобы не пропустить изменения;
+	// если не удалось (например, исчерпан лимит max_user_watches), проверяем время изменения
+	watched := false
+
+	if c.watcher != nil {
+		if err = c.watcher.Add(path); err != nil {
+			log.Warnf("%v: каталог будет проверяться по времени изменения", err)
+		} else {
+			watched = true
+		}
+	}
+
+	names, err := readNames(path)
+	if err != nil {
+		if watched {
+			c.mu.Lock()
+			c.unwatch(path)
+			c.mu.Unlock()
+		}
+
+		return nil, err
+	}
+
+	l = &listing{
+		names:    names,
+		watched:  watched,
+		modTime:  modTime,
+		lastUsed: time.Now(),
+		rendered: make(map[pageKey][]byte),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// каталог изменился, пока мы его читали: содержимое не сохраняем и не отслеживаем
+	if generation != c.generation {
+		if watched {
+			c.unwatch(path)
+		}
+
+		return l, nil
+	}
+
+	if _, ok := c.listings[path]; !ok && len(c.listings) >= c.maxDirs {
+		c.evict()
+	}
+
+	c.listings[path] = l
+
+	return l, nil
+}
+
+// перестаем отслеживать каталог, если в кеше нет отслеживаемого содержимого для него;
+// вызывается под мьютексом
+func (c *Cache) unwatch(path string) {
+	if l, ok := c.listings[path]; ok && l.watched {
+		return
+	}
+
+	c.watcher.Remove(path)
+}
+
+// вытесняем давно не использованный каталог; вызывается под мьютексом
+func (c *Cache) evict() {
+	var (
+		oldest string
+		last   time.Time
+	)
+
+	for path, l := range c.listings {
+		if oldest == "" || l.lastUsed.Before(last) {
+			oldest, last = path, l.lastUsed
+		}
+	}
+
+	c.remove(oldest)
+}
+
+// удаляем каталог из кеша; вызывается под мьютексом
+func (c *Cache) remove(path string) {
+	if _, ok := c.listings[path]; !ok {
+		return
+	}
+
+	delete(c.listings, path)
+
+	if c.watcher != nil {
+		c.watcher.Remove(path)
+	}
+}
+
+// Purge - удалить из кеша содержимое всех каталогов
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for path := range c.listings {
+		c.remove(path)
+	}
+}
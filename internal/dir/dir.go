@@ -5,28 +5,44 @@ import (
 	"bytes"
 	"html/template"
 	"os"
-	"path/filepath"
-
-	"github.com/Kostushka/tcp_server/internal/log"
 )
 
-// ShowDir - отправляем клиенту содержимое каталога
-func ShowDir(rootPath, queryPath string, t *template.Template) (*bytes.Buffer, error) {
-	type args struct {
-		RootPath string
-		DirName  string
-		Files    []string
+// Page - параметры постраничного вывода содержимого каталога
+type Page struct {
+	// Number - номер страницы, начиная с 1
+	Number int
+	// PerPage - количество файлов на странице, 0 - выводить все файлы на одной странице
+	PerPage int
+}
+
+// ShowDir - отправляем клиенту содержимое каталога dirPath, запрошенного по пути urlPath
+func ShowDir(dirPath, urlPath string, t *template.Template, page Page) (*bytes.Buffer, error) {
+	// получаем имена файлов, находящихся в каталоге
+	names, err := readNames(dirPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// получаем файлы, находящиеся в каталоге
-	files, err := os.ReadDir(filepath.Join(rootPath, queryPath))
+	return render(dirPath, urlPath, t, names, page)
+}
+
+// LoadTemplate - читаем и парсим шаблон страницы со списком файлов
+func LoadTemplate(path string) (*template.Template, error) {
+	templ, err := os.ReadFile(path) //nolint:gosec
 	if err != nil {
-		log.Errorf(err)
+		return nil, err
+	}
 
+	return template.New("index").Parse(string(templ))
+}
+
+// получаем имена файлов каталога, скрытые файлы пропускаем
+func readNames(path string) ([]string, error) {
+	files, err := os.ReadDir(path)
+	if err != nil {
 		return nil, err
 	}
 
-	// получаем имена файлов
 	names := []string{}
 
 	for _, v := range files {
@@ -37,19 +53,67 @@ func ShowDir(rootPath, queryPath string, t *template.Template) (*bytes.Buffer, e
 		names = append(names, v.Name())
 	}
 
+	return names, nil
+}
+
+// применяем шаблон к странице со списком файлов каталога
+func render(dirPath, urlPath string, t *template.Template, names []string, page Page) (*bytes.Buffer, error) {
+	type args struct {
+		RootPath string
+		DirName  string
+		Files    []string
+		// данные для постраничного вывода
+		Page     int
+		Pages    int
+		PerPage  int
+		Total    int
+		PrevPage int
+		NextPage int
+	}
+
+	total := len(names)
+	pages := 1
+
+	// оставляем только файлы запрошенной страницы
+	if page.PerPage > 0 && total > page.PerPage {
+		pages = (total + page.PerPage - 1) / page.PerPage
+
+		page.Number = min(max(page.Number, 1), pages)
+
+		start := (page.Number - 1) * page.PerPage
+		names = names[start:min(start+page.PerPage, total)]
+	} else {
+		page.Number = 1
+	}
+
+	var prevPage, nextPage int
+	if page.Number > 1 {
+		prevPage = page.Number - 1
+	}
+
+	if page.Number < pages {
+		nextPage = page.Number + 1
+	}
+
 	// если запрос идет на корень, то оставляем переменную с путем запроса пустой,
 	// так как по умолчанию в html шаблоне
 	// путь запроса до директории и имена содержащихся в ней файлов/каталогов разделяет слеш
-	if queryPath == "/" {
-		queryPath = ""
+	if urlPath == "/" {
+		urlPath = ""
 	}
 
 	buf := new(bytes.Buffer)
 	// применяем шаблон к структуре данных, пишем выходные данные в буфер
-	err = t.Execute(buf, args{
-		RootPath: filepath.Join(rootPath, queryPath),
-		DirName:  queryPath,
+	err := t.Execute(buf, args{
+		RootPath: dirPath,
+		DirName:  urlPath,
 		Files:    names,
+		Page:     page.Number,
+		Pages:    pages,
+		PerPage:  page.PerPage,
+		Total:    total,
+		PrevPage: prevPage,
+		NextPage: nextPage,
 	})
 	if err != nil {
 		return nil, err
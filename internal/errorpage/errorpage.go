@@ -0,0 +1,212 @@
+// Package errorpage - пакет со страницами ошибок: встроенными HTML, JSON и текстом
+// и шаблонами из файлов, заданными для отдельных статусов
+package errorpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Kostushka/tcp_server/internal/connection/headerdata"
+)
+
+// ErrInvalidPage - некорректные настройки страницы ошибки
+var ErrInvalidPage = errors.New("некорректные настройки страницы ошибки")
+
+// Config - шаблоны страниц ошибок: ключ - статус ("404") или класс статусов ("5xx"),
+// значение - файл шаблона; тип содержимого определяется по расширению файла
+type Config map[string]string
+
+// Data - данные, доступные в шаблоне страницы ошибки
+type Data struct {
+	Status     int    `json:"status"`
+	StatusText string `json:"error"`
+	Method     string `json:"method,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Host       string `json:"host,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// шаблон страницы ошибки из файла
+type page struct {
+	t           *template.Template
+	contentType string
+}
+
+// Pages - страницы ошибок; статусы без своего шаблона ищутся в parent,
+// если шаблона нет нигде, отправляется встроенная страница
+type Pages struct {
+	pages  map[string]*page
+	parent *Pages
+}
+
+// New - загрузить шаблоны страниц ошибок; parent - страницы, к которым обращаемся
+// для статусов без своего шаблона, nil - только встроенные страницы
+func New(cfg Config, parent *Pages) (*Pages, error) {
+	if len(cfg) == 0 {
+		return parent, nil
+	}
+
+	p := &Pages{pages: make(map[string]*page, len(cfg)), parent: parent}
+
+	for key, file := range cfg {
+		if !validKey(key) {
+			return nil, fmt.Errorf("%w: %q - ожидается статус 400-599 или класс 4xx, 5xx", ErrInvalidPage, key)
+		}
+
+		t, err := template.New(filepath.Base(file)).Option("missingkey=zero").ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: шаблон для %s: %w", ErrInvalidPage, key, err)
+		}
+
+		p.pages[strings.ToLower(key)] = &page{t: t, contentType: headerdata.ContentType(file)}
+	}
+
+	return p, nil
+}
+
+// ключ - статус ошибки или класс статусов
+func validKey(key string) bool {
+	switch strings.ToLower(key) {
+	case "4xx", "5xx":
+		return true
+	}
+
+	code, err := strconv.Atoi(key)
+
+	return err == nil && code >= 400 && code <= 599
+}
+
+// найти шаблон для статуса: сначала по статусу, затем по классу, затем у parent
+func (p *Pages) lookup(status int) *page {
+	for ; p != nil; p = p.parent {
+		if pg, ok := p.pages[strconv.Itoa(status)]; ok {
+			return pg
+		}
+
+		if pg, ok := p.pages[strconv.Itoa(status/100)+"xx"]; ok {
+			return pg
+		}
+	}
+
+	return nil
+}
+
+// Render - тело страницы ошибки и его тип; accept - заголовок Accept запроса,
+// по нему выбирается формат встроенной страницы
+func (p *Pages) Render(accept string, data Data) (string, []byte, error) {
+	if data.StatusText == "" {
+		data.StatusText = http.StatusText(data.Status)
+	}
+
+	pg := p.lookup(data.Status)
+	if pg == nil {
+		contentType, body := builtin(accept, data)
+
+		return contentType, body, nil
+	}
+
+	var buf bytes.Buffer
+
+	if err := pg.t.Execute(&buf, data); err != nil {
+		// страница ошибки не должна остаться пустой из-за ошибки в шаблоне
+		contentType, body := builtin(accept, data)
+
+		return contentType, body, fmt.Errorf("ошибка в шаблоне страницы ошибки %d: %w", data.Status, err)
+	}
+
+	return pg.contentType, buf.Bytes(), nil
+}
+
+var htmlPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+{{if .Path}}<p>{{.Method}} {{.Path}}</p>{{end}}
+<hr>
+{{if .RequestID}}<p><small>request id: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`))
+
+// встроенная страница ошибки в формате, который клиент предпочитает
+func builtin(accept string, data Data) (string, []byte) {
+	switch negotiate(accept) {
+	case "application/json":
+		body, _ := json.Marshal(data) //nolint:errchkjson
+
+		return "application/json", append(body, '\n')
+	case "text/plain":
+		return "text/plain; charset=utf-8", []byte(fmt.Sprintf("%d %s\n", data.Status, data.StatusText))
+	default:
+		var buf bytes.Buffer
+		_ = htmlPage.Execute(&buf, data) //nolint:errcheck
+
+		return "text/html; charset=utf-8", buf.Bytes()
+	}
+}
+
+// форматы встроенной страницы в порядке предпочтения при равном весе
+var formats = []string{"text/html", "application/json", "text/plain"}
+
+// выбрать формат страницы по заголовку Accept с учетом весов q; без заголовка - HTML
+func negotiate(accept string) string {
+	best, bestQ := formats[0], 0.0
+
+	if strings.TrimSpace(accept) == "" {
+		return best
+	}
+
+	for _, f := range formats {
+		if q := quality(accept, f); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	return best
+}
+
+// вес формата в заголовке Accept: точное совпадение важнее type/* и */*
+func quality(accept, format string) float64 {
+	q, specificity := 0.0, -1
+	typ, _, _ := strings.Cut(format, "/")
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		s := -1
+
+		switch mediaType {
+		case format:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+
+		for _, param := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+
+	return q
+}
@@ -0,0 +1,432 @@
+// Package fastcgi - пакет с клиентом FastCGI и обработчиком, передающим запросы серверу приложений
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// типы записей FastCGI
+const (
+	typeBeginRequest = 1
+	typeEndRequest   = 3
+	typeParams       = 4
+	typeStdin        = 5
+	typeStdout       = 6
+	typeStderr       = 7
+)
+
+const (
+	version = 1
+	// роль приложения: формирует ответ на запрос
+	roleResponder = 1
+	// флаг BEGIN_REQUEST: приложение не закрывает соединение после ответа
+	flagKeepConn = 1
+	// все запросы в соединении передаются по одному, поэтому идентификатор постоянный
+	requestID = 1
+	// statusRequestComplete - приложение обработало запрос
+	statusRequestComplete = 0
+
+	headerLen     = 8
+	maxContentLen = 65535
+)
+
+var (
+	// ErrProtocol - сервер приложений нарушил протокол FastCGI
+	ErrProtocol = errors.New("нарушение протокола FastCGI")
+	// ErrRequestRejected - сервер приложений отказался обрабатывать запрос
+	ErrRequestRejected = errors.New("сервер приложений отказался обрабатывать запрос")
+)
+
+// ClientConfig - параметры соединения с сервером приложений
+type ClientConfig struct {
+	// Address - адрес сервера: "host:port" или "unix:/path/to/socket"
+	Address string
+	// ConnectTimeout - время установки соединения
+	ConnectTimeout time.Duration
+	// Timeout - время обработки одного запроса, включая передачу ответа
+	Timeout time.Duration
+	// MaxIdle - сколько простаивающих соединений с сервером хранить для повторного использования
+	MaxIdle int
+}
+
+// Client - клиент FastCGI
+type Client struct {
+	cfg     ClientConfig
+	network string
+	address string
+	pool    *pool
+}
+
+// пул простаивающих соединений с сервером
+type pool struct {
+	mu   sync.Mutex
+	idle []net.Conn
+}
+
+// пулы общие для всех клиентов одного адреса: после перезагрузки конфигурации
+// новые клиенты используют уже открытые соединения, а не оставляют их висеть
+var pools sync.Map
+
+// NewClient - создать клиента для сервера приложений cfg.Address
+func NewClient(cfg ClientConfig) *Client {
+	c := &Client{cfg: cfg, network: "tcp", address: cfg.Address}
+
+	if path, ok := strings.CutPrefix(cfg.Address, "unix:"); ok {
+		c.network, c.address = "unix", path
+	}
+
+	p, _ := pools.LoadOrStore(c.network+":"+c.address, &pool{})
+	c.pool = p.(*pool) //nolint:forcetypeassert
+
+	return c
+}
+
+// взять соединение из пула или установить новое; reused - соединение уже использовалось
+func (c *Client) conn() (net.Conn, bool, error) {
+	c.pool.mu.Lock()
+
+	if n := len(c.pool.idle); n > 0 {
+		conn := c.pool.idle[n-1]
+		c.pool.idle = c.pool.idle[:n-1]
+		c.pool.mu.Unlock()
+
+		return conn, true, nil
+	}
+
+	c.pool.mu.Unlock()
+
+	conn, err := net.DialTimeout(c.network, c.address, c.cfg.ConnectTimeout)
+
+	return conn, false, err
+}
+
+// вернуть соединение в пул, если в нем есть место
+func (c *Client) release(conn net.Conn) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	if len(c.pool.idle) >= c.cfg.MaxIdle {
+		conn.Close()
+
+		return
+	}
+
+	c.pool.idle = append(c.pool.idle, conn)
+}
+
+// Do - передать серверу приложений параметры и тело запроса; stdin - nil, если тела нет;
+// stderr получает сообщения приложения построчно.
+// Ответ читается из Response, после чтения его нужно закрыть
+func (c *Client) Do(params []string, stdin io.Reader, stderr func(line string)) (*Response, error) {
+	for {
+		conn, reused, err := c.conn()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(conn, params, stdin, stderr)
+		if err == nil {
+			return resp, nil
+		}
+
+		conn.Close()
+
+		// сервер мог закрыть простаивавшее соединение; запрос без тела повторяем на новом
+		if reused && stdin == nil && !errors.Is(err, ErrRequestRejected) {
+			continue
+		}
+
+		return nil, err
+	}
+}
+
+// передать запрос по соединению conn и прочитать начало ответа
+func (c *Client) do(conn net.Conn, params []string, stdin io.Reader, stderr func(string)) (*Response, error) {
+	// у соединения из пула может остаться срок предыдущего запроса
+	var deadline time.Time
+	if c.cfg.Timeout > 0 {
+		deadline = time.Now().Add(c.cfg.Timeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(conn)
+
+	begin := [8]byte{0, roleResponder, flagKeepConn}
+	if err := writeRecord(w, typeBeginRequest, begin[:]); err != nil {
+		return nil, err
+	}
+
+	if err := writeStream(w, typeParams, encodeParams(params)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	// тело запроса передаем по мере чтения из клиентского соединения
+	if err := copyStdin(w, stdin); err != nil {
+		return nil, err
+	}
+
+	resp := &Response{c: c, conn: conn, r: bufio.NewReader(conn), stderr: stderr}
+
+	// ждем первую запись ответа, чтобы ошибка соединения вернулась из Do, а не из Read;
+	// io.EOF - ответ уже завершен записью END_REQUEST
+	if err := resp.fill(); err != nil && !(resp.done && errors.Is(err, io.EOF)) {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// передать тело запроса записями STDIN и завершить поток пустой записью
+func copyStdin(w *bufio.Writer, stdin io.Reader) error {
+	if stdin != nil {
+		buf := make([]byte, maxContentLen)
+
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				if werr := writeRecord(w, typeStdin, buf[:n]); werr != nil {
+					return werr
+				}
+			}
+
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				return fmt.Errorf("тело запроса не прочитано: %w", err)
+			}
+		}
+	}
+
+	if err := writeRecord(w, typeStdin, nil); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// Response - ответ сервера приложений: поток STDOUT
+type Response struct {
+	c      *Client
+	conn   net.Conn
+	r      *bufio.Reader
+	stderr func(string)
+	// buf - прочитанные, но еще не отданные данные STDOUT
+	buf []byte
+	// stderrBuf - незавершенная строка STDERR
+	stderrBuf []byte
+	// done - получена запись END_REQUEST
+	done bool
+	err  error
+}
+
+// Read - прочитать данные ответа
+func (r *Response) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// Close - завершить чтение ответа: полностью прочитанное соединение возвращается в пул
+func (r *Response) Close() error {
+	r.flushStderr()
+
+	if r.done && r.err == nil {
+		r.c.release(r.conn)
+
+		return nil
+	}
+
+	// ответ прочитан не до конца: соединение нельзя использовать повторно
+	return r.conn.Close()
+}
+
+// прочитать следующую запись ответа
+func (r *Response) fill() error {
+	if r.done || r.err != nil {
+		if r.err != nil {
+			return r.err
+		}
+
+		return io.EOF
+	}
+
+	typ, content, err := readRecord(r.r)
+	if err != nil {
+		// сервер закрыл соединение, не завершив ответ записью END_REQUEST
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		r.err = err
+
+		return err
+	}
+
+	switch typ {
+	case typeStdout:
+		r.buf = content
+	case typeStderr:
+		r.writeStderr(content)
+	case typeEndRequest:
+		r.done = true
+
+		if len(content) < 8 {
+			r.err = fmt.Errorf("%w: короткая запись END_REQUEST", ErrProtocol)
+
+			return r.err
+		}
+
+		if status := content[4]; status != statusRequestComplete {
+			r.err = fmt.Errorf("%w: статус %d", ErrRequestRejected, status)
+
+			return r.err
+		}
+
+		return io.EOF
+	default:
+		r.err = fmt.Errorf("%w: неожиданная запись типа %d", ErrProtocol, typ)
+
+		return r.err
+	}
+
+	return nil
+}
+
+// передать сообщения STDERR построчно
+func (r *Response) writeStderr(p []byte) {
+	r.stderrBuf = append(r.stderrBuf, p...)
+
+	for {
+		i := bytes.IndexByte(r.stderrBuf, '\n')
+		if i == -1 {
+			return
+		}
+
+		if r.stderr != nil {
+			r.stderr(strings.TrimRight(string(r.stderrBuf[:i]), "\r"))
+		}
+
+		r.stderrBuf = r.stderrBuf[i+1:]
+	}
+}
+
+// передать последнюю строку STDERR без перевода строки
+func (r *Response) flushStderr() {
+	if len(r.stderrBuf) > 0 && r.stderr != nil {
+		r.stderr(string(r.stderrBuf))
+	}
+
+	r.stderrBuf = nil
+}
+
+// записать поток: данные частями и завершающую пустую запись
+func writeStream(w *bufio.Writer, typ uint8, data []byte) error {
+	for len(data) > 0 {
+		n := min(len(data), maxContentLen)
+		if err := writeRecord(w, typ, data[:n]); err != nil {
+			return err
+		}
+
+		data = data[n:]
+	}
+
+	return writeRecord(w, typ, nil)
+}
+
+// записать одну запись; содержимое выравнивается до 8 байт
+func writeRecord(w *bufio.Writer, typ uint8, content []byte) error {
+	padding := (8 - len(content)%8) % 8
+
+	var h [headerLen]byte
+
+	h[0] = version
+	h[1] = typ
+	binary.BigEndian.PutUint16(h[2:], requestID)
+	binary.BigEndian.PutUint16(h[4:], uint16(len(content))) //nolint:gosec
+	h[6] = byte(padding)
+
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+
+	_, err := w.Write(make([]byte, padding))
+
+	return err
+}
+
+// прочитать одну запись
+func readRecord(r *bufio.Reader) (uint8, []byte, error) {
+	var h [headerLen]byte
+
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+
+	if h[0] != version {
+		return 0, nil, fmt.Errorf("%w: версия %d", ErrProtocol, h[0])
+	}
+
+	if id := binary.BigEndian.Uint16(h[2:]); id != requestID {
+		return 0, nil, fmt.Errorf("%w: запись для запроса %d", ErrProtocol, id)
+	}
+
+	content := make([]byte, int(binary.BigEndian.Uint16(h[4:]))+int(h[6]))
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+
+	return h[1], content[:binary.BigEndian.Uint16(h[4:])], nil
+}
+
+// закодировать параметры NAME=value в пары имя-значение FastCGI
+func encodeParams(params []string) []byte {
+	var buf []byte
+
+	for _, p := range params {
+		name, value, _ := strings.Cut(p, "=")
+		buf = appendLen(buf, len(name))
+		buf = appendLen(buf, len(value))
+		buf = append(buf, name...)
+		buf = append(buf, value...)
+	}
+
+	return buf
+}
+
+// длина до 127 - один байт, иначе четыре байта со старшим битом
+func appendLen(buf []byte, n int) []byte {
+	if n < 128 {
+		return append(buf, byte(n))
+	}
+
+	return binary.BigEndian.AppendUint32(buf, uint32(n)|1<<31) //nolint:gosec
+}
@@ -0,0 +1,226 @@
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// локальный сервер приложений FastCGI: отвечает параметрами и размером тела запроса,
+// пишет в STDERR несколько строк и, если задано closeAfter, закрывает соединение после ответа
+type responder struct {
+	l          net.Listener
+	accepted   atomic.Int64
+	closeAfter bool
+}
+
+func newResponder(t *testing.T, closeAfter bool) *responder {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	r := &responder{l: l, closeAfter: closeAfter}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			r.accepted.Add(1)
+
+			go r.serve(conn)
+		}
+	}()
+
+	return r
+}
+
+func (r *responder) client() *Client {
+	return NewClient(ClientConfig{Address: r.l.Addr().String(), ConnectTimeout: time.Second, Timeout: 5 * time.Second, MaxIdle: 1})
+}
+
+// обслуживаем запросы в соединении по одному
+func (r *responder) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+
+	for {
+		var params, stdin []byte
+
+		paramsDone, stdinDone := false, false
+
+		for !paramsDone || !stdinDone {
+			typ, content, err := readRecord(br)
+			if err != nil {
+				return
+			}
+
+			switch typ {
+			case typeParams:
+				params = append(params, content...)
+				paramsDone = len(content) == 0
+			case typeStdin:
+				stdin = append(stdin, content...)
+				stdinDone = len(content) == 0
+			}
+		}
+
+		var out bytes.Buffer
+
+		out.WriteString("Content-Type: text/plain\r\n\r\n")
+
+		for _, p := range decodeParams(params) {
+			out.WriteString(p + "\n")
+		}
+
+		fmt.Fprintf(&out, "stdin=%d\n", len(stdin))
+
+		w := bufio.NewWriter(conn)
+		_ = writeRecord(w, typeStderr, []byte("line1\nli"))
+		_ = writeRecord(w, typeStderr, []byte("ne2\ntail"))
+		_ = writeStream(w, typeStdout, out.Bytes())
+		_ = writeRecord(w, typeEndRequest, make([]byte, 8))
+
+		if w.Flush() != nil {
+			return
+		}
+
+		// закрываем только запись: следующий запрос клиент получит с конца потока (EOF), а не со сбросом
+		if r.closeAfter {
+			_ = conn.(*net.TCPConn).CloseWrite() //nolint:forcetypeassert
+			_, _ = io.Copy(io.Discard, conn)
+
+			return
+		}
+	}
+}
+
+// разобрать пары имя-значение FastCGI в строки NAME=value
+func decodeParams(b []byte) []string {
+	var params []string
+
+	readLen := func() int {
+		if b[0]>>7 == 0 {
+			n := int(b[0])
+			b = b[1:]
+
+			return n
+		}
+
+		n := int(binary.BigEndian.Uint32(b) &^ (1 << 31))
+		b = b[4:]
+
+		return n
+	}
+
+	for len(b) > 0 {
+		nameLen := readLen()
+		valueLen := readLen()
+		params = append(params, string(b[:nameLen])+"="+string(b[nameLen:nameLen+valueLen]))
+		b = b[nameLen+valueLen:]
+	}
+
+	return params
+}
+
+// выполнить запрос и прочитать ответ целиком
+func do(t *testing.T, c *Client, params []string, stdin io.Reader) (string, []string) {
+	t.Helper()
+
+	var stderr []string
+
+	resp, err := c.Do(params, stdin, func(line string) { stderr = append(stderr, line) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = resp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body), stderr
+}
+
+func TestDo(t *testing.T) {
+	r := newResponder(t, false)
+	long := strings.Repeat("x", 300)
+	// тело больше одной записи STDIN
+	body := bytes.Repeat([]byte("b"), 2*maxContentLen+10)
+
+	out, stderr := do(t, r.client(), []string{"SHORT=1", "LONG=" + long, long + "=name"}, bytes.NewReader(body))
+
+	for _, want := range []string{"SHORT=1\n", "LONG=" + long + "\n", long + "=name\n", fmt.Sprintf("stdin=%d\n", len(body))} {
+		if !strings.Contains(out, want) {
+			t.Errorf("в ответе %q нет %q", out, want)
+		}
+	}
+
+	if got := strings.Join(stderr, "|"); got != "line1|line2|tail" {
+		t.Errorf("строки STDERR %q, ожидались line1|line2|tail", got)
+	}
+}
+
+func TestConnReuse(t *testing.T) {
+	r := newResponder(t, false)
+	c := r.client()
+
+	for range 3 {
+		do(t, c, []string{"A=1"}, nil)
+	}
+
+	if n := r.accepted.Load(); n != 1 {
+		t.Errorf("установлено %d соединений, ожидалось одно", n)
+	}
+}
+
+func TestRetryClosedConn(t *testing.T) {
+	// сервер закрывает соединение после ответа, как php-fpm по idle timeout или max_requests
+	r := newResponder(t, true)
+	c := r.client()
+
+	do(t, c, []string{"A=1"}, nil)
+	// даем закрытию соединения дойти до клиента
+	time.Sleep(50 * time.Millisecond)
+
+	out, _ := do(t, c, []string{"A=2"}, nil)
+	if !strings.Contains(out, "A=2") {
+		t.Errorf("ответ %q, ожидался ответ на повторный запрос", out)
+	}
+
+	if n := r.accepted.Load(); n != 2 {
+		t.Errorf("установлено %d соединений, ожидалось 2", n)
+	}
+
+	// запрос с телом не повторяется
+	time.Sleep(50 * time.Millisecond)
+
+	resp, err := c.Do([]string{"A=3"}, strings.NewReader("body"), nil)
+	if err == nil {
+		resp.Close()
+		t.Fatal("запрос с телом по закрытому соединению выполнен без ошибки")
+	}
+
+	if n := r.accepted.Load(); n != 2 {
+		t.Errorf("запрос с телом повторен на новом соединении")
+	}
+}
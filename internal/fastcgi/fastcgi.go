@@ -0,0 +1,216 @@
+package fastcgi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/cgi"
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/handler"
+)
+
+const (
+	defaultIndex          = "index.php"
+	defaultExtension      = ".php"
+	defaultConnectTimeout = 5 * time.Second
+	defaultTimeout        = 60 * time.Second
+	defaultMaxIdle        = 8
+)
+
+// ErrInvalidConfig - некорректные параметры FastCGI
+var ErrInvalidConfig = errors.New("некорректные параметры FastCGI")
+
+// Config - параметры передачи запросов серверу приложений FastCGI
+type Config struct {
+	// Address - адрес сервера приложений: "host:port" или "unix:/path/to/socket"
+	Address string
+	// Root - каталог со скриптами; в нем проверяется, что скрипт существует
+	Root string
+	// Prefix - начало пути запроса, которое заменяется каталогом Root (alias)
+	Prefix string
+	// ScriptRoot - каталог со скриптами на стороне сервера приложений, из которого строится
+	// SCRIPT_FILENAME; если задан, существование скрипта локально не проверяется
+	ScriptRoot string
+	// Index - скрипт, выполняемый для пути без скрипта, по умолчанию index.php
+	Index string
+	// Extensions - расширения скриптов, по умолчанию .php
+	Extensions []string
+	// ConnectTimeout - время установки соединения, по умолчанию 5s
+	ConnectTimeout time.Duration
+	// Timeout - время обработки запроса, по умолчанию 60s
+	Timeout time.Duration
+	// MaxIdle - простаивающих соединений для повторного использования, по умолчанию 8
+	MaxIdle int
+	// Params - дополнительные параметры запроса
+	Params map[string]string
+}
+
+// FastCGI - обработчик, передающий запросы к скриптам серверу приложений
+type FastCGI struct {
+	cfg    Config
+	client *Client
+}
+
+// New - создать обработчик для сервера приложений cfg.Address
+func New(cfg Config) (*FastCGI, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("%w: не указан адрес сервера приложений", ErrInvalidConfig)
+	}
+
+	if cfg.Index == "" {
+		cfg.Index = defaultIndex
+	}
+
+	if len(cfg.Extensions) == 0 {
+		cfg.Extensions = []string{defaultExtension}
+	}
+
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaultConnectTimeout
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.MaxIdle <= 0 {
+		cfg.MaxIdle = defaultMaxIdle
+	}
+
+	return &FastCGI{
+		cfg: cfg,
+		client: NewClient(ClientConfig{
+			Address:        cfg.Address,
+			ConnectTimeout: cfg.ConnectTimeout,
+			Timeout:        cfg.Timeout,
+			MaxIdle:        cfg.MaxIdle,
+		}),
+	}, nil
+}
+
+// ServeHTTP - передать запрос серверу приложений и отправить клиенту его ответ
+func (f *FastCGI) ServeHTTP(w handler.ResponseWriter, r *handler.Request) {
+	s, ok := f.script(r.Path())
+	if !ok {
+		w.WriteHeader(consts.StatusNotFound)
+		r.Log().Errorf("скрипт для пути %q не найден", r.Path())
+
+		return
+	}
+
+	params := append(cgi.Env(r, s),
+		"DOCUMENT_ROOT="+f.docRoot(),
+		// PHP с cgi.force_redirect выполняет скрипт, только если сервер передал этот параметр
+		"REDIRECT_STATUS=200",
+	)
+
+	for name, v := range f.cfg.Params {
+		params = append(params, name+"="+v)
+	}
+
+	// без тела Client передает только пустой поток STDIN
+	var stdin io.Reader
+
+	if length, err := strconv.ParseInt(r.Header("Content-Length"), 10, 64); err == nil && length > 0 {
+		stdin = r.Body()
+	}
+
+	resp, err := f.client.Do(params, stdin, func(line string) {
+		r.Log().Warnf("сервер приложений %s: %s", f.cfg.Address, line)
+	})
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		r.Log().Errorf("сервер приложений %s не обработал запрос к %q: %v", f.cfg.Address, s.File, err)
+
+		return
+	}
+	defer resp.Close()
+
+	r.Log().Infof("запрос к %q передан серверу приложений %s", s.File, f.cfg.Address)
+
+	err = cgi.SendResponse(w, r, bufio.NewReader(resp))
+	if err == nil {
+		return
+	}
+
+	r.Log().Errorf("%v", err)
+
+	// заголовки еще не отправлены - клиент получит ошибку, иначе обрываем ответ
+	if errors.Is(err, cgi.ErrInvalidResponse) {
+		w.WriteHeader(errorStatus(err))
+
+		return
+	}
+
+	panic(http.ErrAbortHandler)
+}
+
+// каталог со скриптами на стороне сервера приложений
+func (f *FastCGI) docRoot() string {
+	if f.cfg.ScriptRoot != "" {
+		return f.cfg.ScriptRoot
+	}
+
+	return f.cfg.Root
+}
+
+// найти скрипт по пути запроса: первая часть пути с расширением скрипта, остаток - PATH_INFO;
+// для пути без скрипта выполняется Index
+func (f *FastCGI) script(urlPath string) (cgi.Script, bool) {
+	rel := "/" + strings.TrimPrefix(strings.TrimPrefix(urlPath, f.cfg.Prefix), "/")
+	parts := strings.Split(rel, "/")
+
+	relScript, pathInfo := path.Join(rel, f.cfg.Index), ""
+
+	for i, part := range parts {
+		if slices.Contains(f.cfg.Extensions, path.Ext(part)) {
+			relScript = strings.Join(parts[:i+1], "/")
+
+			if i+1 < len(parts) {
+				pathInfo = "/" + strings.Join(parts[i+1:], "/")
+			}
+
+			break
+		}
+	}
+
+	if f.cfg.ScriptRoot == "" {
+		fi, err := os.Stat(filepath.Join(f.cfg.Root, relScript))
+		if err != nil || !fi.Mode().IsRegular() {
+			return cgi.Script{}, false
+		}
+	}
+
+	s := cgi.Script{
+		File:     filepath.Join(f.docRoot(), relScript),
+		Name:     path.Join("/", f.cfg.Prefix, relScript),
+		PathInfo: pathInfo,
+	}
+
+	if pathInfo != "" {
+		s.PathTranslated = filepath.Join(f.docRoot(), pathInfo)
+	}
+
+	return s, true
+}
+
+// статус ответа клиенту при ошибке сервера приложений
+func errorStatus(err error) int {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return consts.StatusGatewayTimeout
+	}
+
+	return consts.StatusBadGateway
+}
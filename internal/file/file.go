@@ -22,8 +22,8 @@ func Open(path string) (*os.File, error) {
 	return f, nil
 }
 
-// Send - отправляем клиенту файл
-func Send(w io.Writer, f *os.File) error {
+// Send - отправляем клиенту файл; l - логер запроса
+func Send(w io.Writer, f *os.File, l *log.Logger) error {
 	// читаем файл
 	fileBuf := make([]byte, consts.BufSize)
 	// если указать размер буфера больше размера файла, то буфер будет содержать в конце нули
@@ -51,7 +51,7 @@ func Send(w io.Writer, f *os.File) error {
 		}
 	}
 
-	log.Infof("клиенту отправлено тело ответа")
+	l.Infof("клиенту отправлено тело ответа")
 
 	return nil
 }
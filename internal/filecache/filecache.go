@@ -0,0 +1,194 @@
+// Package filecache - пакет с LRU-кешем содержимого небольших часто запрашиваемых файлов
+package filecache
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry - закешированный файл: содержимое и метаданные
+type Entry struct {
+	path     string
+	data     []byte
+	name     string
+	size     int64
+	modTime  time.Time
+	loadedAt time.Time
+}
+
+// Data - возвращает содержимое файла
+func (e *Entry) Data() []byte {
+	return e.data
+}
+
+// Name - возвращает имя файла
+func (e *Entry) Name() string {
+	return e.name
+}
+
+// Size - возвращает размер файла
+func (e *Entry) Size() int64 {
+	return e.size
+}
+
+// ModTime - возвращает время последнего изменения файла
+func (e *Entry) ModTime() time.Time {
+	return e.modTime
+}
+
+// Cache - LRU-кеш файлов с ограничением по суммарному объему
+type Cache struct {
+	mu sync.Mutex
+	// список записей: в начале - недавно использованные, в конце - кандидаты на вытеснение
+	lru     *list.List
+	entries map[string]*list.Element
+
+	maxBytes int64
+	maxEntry int64
+	ttl      time.Duration
+	curBytes int64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// New - создать кеш; maxBytes - суммарный объем кеша, maxEntry - максимальный размер одного файла,
+// ttl - время жизни записи (0 - без ограничения)
+func New(maxBytes, maxEntry int64, ttl time.Duration) *Cache {
+	// файл больше всего кеша закешировать нельзя
+	if maxEntry <= 0 || maxEntry > maxBytes {
+		maxEntry = maxBytes
+	}
+
+	return &Cache{
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		maxBytes: maxBytes,
+		maxEntry: maxEntry,
+		ttl:      ttl,
+	}
+}
+
+// Fits - проверяет, может ли файл указанного размера быть помещен в кеш
+func (c *Cache) Fits(size int64) bool {
+	return c != nil && size <= c.maxEntry
+}
+
+// Get - возвращает запись из кеша, если она есть и файл на диске не изменился
+func (c *Cache) Get(path string) (*Entry, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[path]
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+
+		return nil, false
+	}
+
+	e := el.Value.(*Entry) //nolint:forcetypeassert
+
+	// запись устарела - удаляем
+	if c.ttl > 0 && time.Since(e.loadedAt) > c.ttl {
+		c.Invalidate(path)
+		c.misses.Add(1)
+
+		return nil, false
+	}
+
+	// файл на диске был изменен или удален - удаляем запись
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || !fi.ModTime().Equal(e.modTime) || fi.Size() != e.size {
+		c.Invalidate(path)
+		c.misses.Add(1)
+
+		return nil, false
+	}
+
+	c.mu.Lock()
+	// запись могла быть удалена, пока проверяли файл
+	if el, ok = c.entries[path]; ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+
+	c.hits.Add(1)
+
+	return e, true
+}
+
+// Put - помещает содержимое файла в кеш, вытесняя давно не использованные записи
+func (c *Cache) Put(path string, data []byte, fi os.FileInfo) {
+	size := int64(len(data))
+	if !c.Fits(size) {
+		return
+	}
+
+	e := &Entry{
+		path:     path,
+		data:     data,
+		name:     fi.Name(),
+		size:     fi.Size(),
+		modTime:  fi.ModTime(),
+		loadedAt: time.Now(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[path]; ok {
+		c.removeElement(el)
+	}
+
+	// освобождаем место под новую запись
+	for c.curBytes+size > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+
+	c.entries[path] = c.lru.PushFront(e)
+	c.curBytes += size
+}
+
+// Invalidate - удаляет запись из кеша
+func (c *Cache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[path]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Purge - удаляет все записи из кеша
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.curBytes = 0
+}
+
+// Stats - возвращает количество попаданий и промахов кеша
+func (c *Cache) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Len - возвращает количество записей и суммарный объем закешированных данных
+func (c *Cache) Len() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries), c.curBytes
+}
+
+// удаляет элемент списка; вызывается под мьютексом
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.lru.Remove(el).(*Entry) //nolint:forcetypeassert
+
+	delete(c.entries, e.path)
+	c.curBytes -= int64(len(e.data))
+}
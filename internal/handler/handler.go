@@ -0,0 +1,43 @@
+// Package handler - пакет с абстракциями обработки запроса: запрос, запись ответа, обработчик
+// и цепочка промежуточных обработчиков (middleware)
+package handler
+
+import "net/http"
+
+// ResponseWriter - запись ответа клиенту
+type ResponseWriter interface {
+	// Header - заголовки ответа; изменения после отправки заголовков не учитываются
+	Header() http.Header
+	// WriteHeader - задать код статуса ответа; заголовки отправляются вместе с первой частью тела
+	// или по завершении обработки, повторные вызовы игнорируются
+	WriteHeader(code int)
+	// Write - отправить часть тела ответа; если статус не задан, отправляется 200.
+	// Без заголовка Content-Length тело передается частями
+	Write(p []byte) (int, error)
+}
+
+// Handler - обработчик запроса
+type Handler interface {
+	ServeHTTP(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc - функция, используемая как обработчик запроса
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeHTTP - вызывает f(w, r)
+func (f HandlerFunc) ServeHTTP(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// Middleware - промежуточный обработчик: получает следующий обработчик цепочки и возвращает обертку над ним
+type Middleware func(next Handler) Handler
+
+// Chain - обернуть обработчик h в цепочку промежуточных обработчиков;
+// первый из них первым получает запрос
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/querydata"
+)
+
+// Request - запрос клиента
+type Request struct {
+	query     *querydata.QueryData
+	body      io.Reader
+	log       *log.Logger
+	requestID string
+	user      string
+	// include - проверка путей, включаемых в ответ без отдельного запроса, nil - пути не проверяются
+	include func(urlPath string) error
+}
+
+// NewRequest - создать запрос из распарсенных данных запроса;
+// body - тело запроса, log - логер запроса, user - пользователь, прошедший аутентификацию
+func NewRequest(query *querydata.QueryData, body io.Reader, l *log.Logger, requestID, user string) *Request {
+	return &Request{
+		query:     query,
+		body:      body,
+		log:       l,
+		requestID: requestID,
+		user:      user,
+	}
+}
+
+// Method - метод запроса
+func (r *Request) Method() string {
+	return r.query.Method()
+}
+
+// Path - декодированный и нормализованный путь запроса
+func (r *Request) Path() string {
+	return r.query.Path()
+}
+
+// SetPath - заменить путь запроса для следующих обработчиков (внутреннее перенаправление)
+func (r *Request) SetPath(path string) {
+	r.query.Rewrite(path, r.query.RawQuery())
+}
+
+// RawQuery - строка параметров запроса без декодирования
+func (r *Request) RawQuery() string {
+	return r.query.RawQuery()
+}
+
+// Query - распарсенные параметры запроса
+func (r *Request) Query() url.Values {
+	return r.query.Query()
+}
+
+// RequestURI - цель запроса из строки запроса без изменений
+func (r *Request) RequestURI() string {
+	return r.query.RequestURI()
+}
+
+// Protocol - версия протокола из строки запроса
+func (r *Request) Protocol() string {
+	return r.query.Protocol()
+}
+
+// Header - значение заголовка запроса
+func (r *Request) Header(name string) string {
+	return r.query.Header(name)
+}
+
+// Headers - все заголовки запроса
+func (r *Request) Headers() map[string]string {
+	return r.query.Headers()
+}
+
+// RemoteAddr - адрес клиента с учетом доверенных прокси
+func (r *Request) RemoteAddr() string {
+	return r.query.Client().Addr
+}
+
+// ClientIP - IP-адрес клиента с учетом доверенных прокси, nil - адрес неизвестен
+func (r *Request) ClientIP() net.IP {
+	return r.query.Client().IP
+}
+
+// Scheme - схема запроса клиента: http или https
+func (r *Request) Scheme() string {
+	return r.query.Client().Scheme
+}
+
+// Host - хост, к которому обращался клиент
+func (r *Request) Host() string {
+	return r.query.Client().Host
+}
+
+// Proxied - пришел ли запрос от доверенного прокси; иначе заголовки X-Forwarded-* и Forwarded
+// задал сам клиент
+func (r *Request) Proxied() bool {
+	return r.query.Client().Proxied
+}
+
+// RequestID - идентификатор запроса
+func (r *Request) RequestID() string {
+	return r.requestID
+}
+
+// User - пользователь, прошедший аутентификацию; пустая строка - аутентификация не требовалась
+func (r *Request) User() string {
+	return r.user
+}
+
+// Body - тело запроса, ограниченное заголовком Content-Length
+func (r *Request) Body() io.Reader {
+	return r.body
+}
+
+// Log - логер запроса: строки содержат идентификатор запроса и данные клиента
+func (r *Request) Log() *log.Logger {
+	return r.log
+}
+
+// SetIncludeCheck - задать проверку путей, которые обработчик включает в ответ без отдельного запроса,
+// например SSI include virtual; сервер проверяет такие пути по тем же правилам, что и запросы клиента
+func (r *Request) SetIncludeCheck(check func(urlPath string) error) {
+	r.include = check
+}
+
+// CheckInclude - можно ли включить в ответ ресурс по пути urlPath;
+// если проверка не задана, путь разрешен
+func (r *Request) CheckInclude(urlPath string) error {
+	if r.include == nil {
+		return nil
+	}
+
+	return r.include(urlPath)
+}
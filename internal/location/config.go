@@ -0,0 +1,170 @@
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+)
+
+// типы сопоставления пути запроса с location
+const (
+	// MatchPrefix - путь запроса начинается с Path
+	MatchPrefix = "prefix"
+	// MatchExact - путь запроса совпадает с Path
+	MatchExact = "exact"
+	// MatchRegex - путь запроса соответствует регулярному выражению Path
+	MatchRegex = "regex"
+)
+
+// обработчики запросов location
+const (
+	// HandlerStatic - отдача файлов из Root или Alias
+	HandlerStatic = "static"
+	// HandlerRedirect - перенаправление на Redirect
+	HandlerRedirect = "redirect"
+	// HandlerProxy - передача запроса вышестоящему серверу ProxyPass
+	HandlerProxy = "proxy"
+	// HandlerCGI - выполнение CGI-скриптов из Root или Alias
+	HandlerCGI = "cgi"
+	// HandlerFastCGI - передача запросов к скриптам серверу приложений FastCGI
+	HandlerFastCGI = "fastcgi"
+)
+
+// Config - настройки location из файла конфигурации сайта
+type Config struct {
+	// Path - префикс, точный путь или регулярное выражение, в зависимости от Match
+	Path string `json:"path"`
+	// Match - тип сопоставления: prefix (по умолчанию), exact или regex
+	Match string `json:"match"`
+	// NoRegex - если префикс оказался самым длинным подходящим, регулярные выражения не проверяются
+	// (модификатор ^~ в nginx)
+	NoRegex bool `json:"no_regex"`
+	// Root - каталог, к которому добавляется путь запроса целиком; пусто - корневой каталог сервера
+	Root string `json:"root"`
+	// Alias - каталог, которым заменяется префикс location в пути запроса
+	Alias string `json:"alias"`
+	// Listing - выводить содержимое каталогов, по умолчанию включено
+	Listing *bool `json:"listing"`
+	// Auth - аутентификация для location, дополнительно к общим правилам сервера
+	Auth *AuthConfig `json:"auth"`
+	// Headers - заголовки, добавляемые к каждому ответу
+	Headers map[string]string `json:"headers"`
+	// Cache - политика кеширования ответов
+	Cache *CacheConfig `json:"cache"`
+	// Markdown - отдавать файлы .md страницами HTML, по умолчанию - как у сервера
+	Markdown *bool `json:"markdown"`
+	// SSI - расширения файлов с директивами SSI, например [".shtml"]; по умолчанию - как у сервера, [] - SSI отключено
+	SSI []string `json:"ssi"`
+	// TryFiles - пути, проверяемые по порядку перед отдачей файла, как try_files в nginx:
+	// ["$uri", "$uri/", "/index.html"]; последний элемент - запасной путь или код вида "=404"
+	TryFiles []string `json:"try_files"`
+	// ErrorPages - шаблоны страниц ошибок location поверх страниц сервера
+	ErrorPages errorpage.Config `json:"error_pages"`
+	// Handler - обработчик запросов: static (по умолчанию), redirect, proxy (ProxyPass или Proxy),
+	// cgi или fastcgi
+	Handler string `json:"handler"`
+	// Redirect - адрес перенаправления; $request_uri заменяется целью исходного запроса
+	Redirect string `json:"redirect"`
+	// Code - код перенаправления, по умолчанию 302
+	Code int `json:"code"`
+	// ProxyPass - адрес вышестоящего сервера вида http://host:port[/path]
+	ProxyPass string `json:"proxy_pass"`
+	// Proxy - несколько вышестоящих серверов, балансировка и время ожидания
+	Proxy *ProxyConfig `json:"proxy"`
+	// CGI - параметры выполнения CGI-скриптов
+	CGI *CGIConfig `json:"cgi"`
+	// FastCGI - параметры сервера приложений FastCGI
+	FastCGI *FastCGIConfig `json:"fastcgi"`
+}
+
+// AuthConfig - аутентификация для location
+type AuthConfig struct {
+	Realm string `json:"realm"`
+	// Type - схема аутентификации: basic (по умолчанию) или digest
+	Type string `json:"type"`
+	// File - файл пользователей в формате htpasswd
+	File string `json:"file"`
+}
+
+// ProxyConfig - вышестоящие серверы location
+type ProxyConfig struct {
+	// Upstreams - адреса серверов вида http://host:port[/path], дополнительно к ProxyPass
+	Upstreams []string `json:"upstreams"`
+	// Balance - выбор сервера: round_robin (по умолчанию) или least_conn
+	Balance string `json:"balance"`
+	// MaxFails - неудачных попыток подряд, после которых сервер исключается на FailTimeout
+	MaxFails int `json:"max_fails"`
+	// FailTimeout - время, на которое недоступный сервер исключается из выбора
+	FailTimeout Duration `json:"fail_timeout"`
+	// ConnectTimeout - время установки соединения с сервером
+	ConnectTimeout Duration `json:"connect_timeout"`
+	// ReadTimeout - время ожидания заголовков ответа сервера
+	ReadTimeout Duration `json:"read_timeout"`
+}
+
+// CGIConfig - параметры выполнения CGI-скриптов location
+type CGIConfig struct {
+	// Extensions - расширения скриптов, например [".cgi", ".pl"]; пусто - выполняется любой файл
+	Extensions []string `json:"extensions"`
+	// Timeout - максимальное время выполнения скрипта, по умолчанию 30s
+	Timeout Duration `json:"timeout"`
+	// Env - дополнительные переменные окружения скриптов
+	Env map[string]string `json:"env"`
+}
+
+// FastCGIConfig - сервер приложений FastCGI location
+type FastCGIConfig struct {
+	// Pass - адрес сервера: "host:port" или "unix:/path/to/socket"
+	Pass string `json:"pass"`
+	// ScriptRoot - каталог со скриптами на стороне сервера приложений, пусто - Root или Alias
+	ScriptRoot string `json:"script_root"`
+	// Index - скрипт для пути без скрипта, по умолчанию index.php
+	Index string `json:"index"`
+	// Extensions - расширения скриптов, по умолчанию [".php"]
+	Extensions []string `json:"extensions"`
+	// ConnectTimeout - время установки соединения, по умолчанию 5s
+	ConnectTimeout Duration `json:"connect_timeout"`
+	// Timeout - время обработки запроса, по умолчанию 60s
+	Timeout Duration `json:"timeout"`
+	// MaxIdle - простаивающих соединений для повторного использования, по умолчанию 8
+	MaxIdle int `json:"max_idle"`
+	// Params - дополнительные параметры запроса
+	Params map[string]string `json:"params"`
+}
+
+// CacheConfig - политика кеширования ответов location
+type CacheConfig struct {
+	// MaxAge - время, в течение которого клиент может использовать ответ без повторного запроса
+	MaxAge Duration `json:"max_age"`
+	// NoStore - запретить клиентам и промежуточным прокси сохранять ответ
+	NoStore bool `json:"no_store"`
+	// FileCache - использовать кеш файлов сервера, по умолчанию включено
+	FileCache *bool `json:"file_cache"`
+}
+
+// Duration - время в файле конфигурации в формате time.ParseDuration, например "1h30m"
+type Duration time.Duration
+
+// UnmarshalJSON - разобрать время из строки
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("время должно быть строкой вида \"1h30m\": %w", err)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// MarshalJSON - записать время строкой
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
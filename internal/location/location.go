@@ -0,0 +1,391 @@
+// Package location - пакет с таблицей маршрутов в стиле nginx: location с собственными корнем,
+// выводом каталогов, аутентификацией, заголовками, кешированием и обработчиком
+package location
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/auth"
+	"github.com/Kostushka/tcp_server/internal/cgi"
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+	"github.com/Kostushka/tcp_server/internal/fastcgi"
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/proxy"
+	"github.com/Kostushka/tcp_server/internal/ssi"
+	"github.com/Kostushka/tcp_server/internal/static"
+)
+
+// ErrInvalidLocation - некорректные настройки location
+var ErrInvalidLocation = errors.New("некорректные настройки location")
+
+// Location - location, готовая к обработке запросов
+type Location struct {
+	cfg     Config
+	re      *regexp.Regexp
+	auth    *auth.Auth
+	handler handler.Handler
+	pages   *errorpage.Pages
+}
+
+// String - location в том виде, в котором она пишется в лог
+func (l *Location) String() string {
+	return l.cfg.Match + " " + l.cfg.Path
+}
+
+// Auth - правила аутентификации location, nil - дополнительная аутентификация не требуется
+func (l *Location) Auth() *auth.Auth {
+	return l.auth
+}
+
+// ErrorPages - страницы ошибок location с учетом страниц сервера
+func (l *Location) ErrorPages() *errorpage.Pages {
+	return l.pages
+}
+
+// Handler - обработчик запросов location с заголовками и политикой кеширования
+func (l *Location) Handler() handler.Handler {
+	return l.handler
+}
+
+// Router - таблица location
+type Router struct {
+	exact map[string]*Location
+	// префиксы упорядочены от длинных к коротким
+	prefixes []*Location
+	// регулярные выражения проверяются в порядке объявления
+	regexps []*Location
+}
+
+// New - создать таблицу location; base - параметры отдачи файлов сервера,
+// на основе которых строятся обработчики static; pages - страницы ошибок сервера
+func New(cfgs []Config, base static.Config, pages *errorpage.Pages) (*Router, error) {
+	r := &Router{exact: make(map[string]*Location)}
+
+	for i, cfg := range cfgs {
+		l, err := newLocation(cfg, base, pages)
+		if err != nil {
+			return nil, fmt.Errorf("location %d (%q): %w", i+1, cfg.Path, err)
+		}
+
+		switch l.cfg.Match {
+		case MatchExact:
+			r.exact[l.cfg.Path] = l
+		case MatchRegex:
+			r.regexps = append(r.regexps, l)
+		default:
+			r.prefixes = append(r.prefixes, l)
+		}
+	}
+
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].cfg.Path) > len(r.prefixes[j].cfg.Path)
+	})
+
+	return r, nil
+}
+
+// Match - найти location для пути запроса, nil - ни одна location не подходит.
+// Как в nginx: точное совпадение; иначе самый длинный подходящий префикс, если у него задан NoRegex;
+// иначе первое подходящее регулярное выражение; иначе самый длинный подходящий префикс
+func (r *Router) Match(path string) *Location {
+	if r == nil {
+		return nil
+	}
+
+	if l, ok := r.exact[path]; ok {
+		return l
+	}
+
+	prefix := r.matchPrefix(path)
+	if prefix != nil && prefix.cfg.NoRegex {
+		return prefix
+	}
+
+	for _, l := range r.regexps {
+		if l.re.MatchString(path) {
+			return l
+		}
+	}
+
+	return prefix
+}
+
+// самый длинный префикс, с которого начинается путь запроса
+func (r *Router) matchPrefix(path string) *Location {
+	for _, l := range r.prefixes {
+		// каталог, запрошенный без завершающего слеша, относится к location "/dir/"
+		if strings.HasPrefix(path, l.cfg.Path) || path+"/" == l.cfg.Path {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// проверить настройки location и создать ее обработчик
+func newLocation(cfg Config, base static.Config, pages *errorpage.Pages) (*Location, error) {
+	l := &Location{cfg: cfg}
+
+	if l.cfg.Match == "" {
+		l.cfg.Match = MatchPrefix
+	}
+
+	if l.cfg.Handler == "" {
+		l.cfg.Handler = HandlerStatic
+	}
+
+	switch l.cfg.Match {
+	case MatchPrefix, MatchExact:
+		if !strings.HasPrefix(cfg.Path, "/") {
+			return nil, fmt.Errorf("%w: путь должен начинаться с /", ErrInvalidLocation)
+		}
+	case MatchRegex:
+		re, err := regexp.Compile(cfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidLocation, err)
+		}
+
+		l.re = re
+	default:
+		return nil, fmt.Errorf("%w: неизвестный тип сопоставления %q", ErrInvalidLocation, cfg.Match)
+	}
+
+	if cfg.Auth != nil {
+		rule := auth.Rule{
+			Prefix: "/",
+			Realm:  cfg.Auth.Realm,
+			Scheme: strings.ToLower(cfg.Auth.Type),
+			File:   cfg.Auth.File,
+		}
+
+		if rule.Scheme == "" {
+			rule.Scheme = auth.SchemeBasic
+		}
+
+		if rule.Realm == "" {
+			rule.Realm = cfg.Path
+		}
+
+		a, err := auth.New([]auth.Rule{rule})
+		if err != nil {
+			return nil, err
+		}
+
+		l.auth = a
+	}
+
+	p, err := errorpage.New(cfg.ErrorPages, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	l.pages = p
+
+	h, err := l.newHandler(base)
+	if err != nil {
+		return nil, err
+	}
+
+	l.handler = withHeaders(h, l.responseHeaders())
+
+	return l, nil
+}
+
+// создать обработчик запросов location
+func (l *Location) newHandler(base static.Config) (handler.Handler, error) {
+	cfg := l.cfg
+
+	switch cfg.Handler {
+	case HandlerStatic:
+		s, err := l.files(base)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.Listing != nil {
+			s.Listing = *cfg.Listing
+		}
+
+		if cfg.Markdown != nil {
+			if *cfg.Markdown && s.MarkdownPages == nil {
+				return nil, fmt.Errorf("%w: шаблон страницы Markdown не загружен", ErrInvalidLocation)
+			}
+
+			s.Markdown = *cfg.Markdown
+		}
+
+		if cfg.SSI != nil {
+			s.SSI = ssi.New(ssi.Config{Extensions: cfg.SSI})
+		}
+
+		if cfg.Cache != nil && cfg.Cache.FileCache != nil && !*cfg.Cache.FileCache {
+			s.FileCache = nil
+		}
+
+		if len(cfg.TryFiles) == 1 {
+			return nil, fmt.Errorf("%w: в try_files нужен хотя бы один путь и запасной вариант", ErrInvalidLocation)
+		}
+
+		s.TryFiles = cfg.TryFiles
+
+		return static.New(s), nil
+	case HandlerCGI:
+		s, err := l.files(base)
+		if err != nil {
+			return nil, err
+		}
+
+		c := cgi.Config{Root: s.Root, Prefix: s.Prefix}
+
+		if cfg.CGI != nil {
+			c.Extensions = cfg.CGI.Extensions
+			c.Timeout = time.Duration(cfg.CGI.Timeout)
+			c.Env = cfg.CGI.Env
+		}
+
+		return cgi.New(c), nil
+	case HandlerFastCGI:
+		if cfg.FastCGI == nil {
+			return nil, fmt.Errorf("%w: не указан сервер приложений FastCGI", ErrInvalidLocation)
+		}
+
+		s, err := l.files(base)
+		if err != nil {
+			return nil, err
+		}
+
+		fc := cfg.FastCGI
+
+		return fastcgi.New(fastcgi.Config{
+			Address:        fc.Pass,
+			Root:           s.Root,
+			Prefix:         s.Prefix,
+			ScriptRoot:     fc.ScriptRoot,
+			Index:          fc.Index,
+			Extensions:     fc.Extensions,
+			ConnectTimeout: time.Duration(fc.ConnectTimeout),
+			Timeout:        time.Duration(fc.Timeout),
+			MaxIdle:        fc.MaxIdle,
+			Params:         fc.Params,
+		})
+	case HandlerRedirect:
+		if cfg.Redirect == "" {
+			return nil, fmt.Errorf("%w: не указан адрес перенаправления", ErrInvalidLocation)
+		}
+
+		code := cfg.Code
+		if code == 0 {
+			code = consts.StatusFound
+		}
+
+		if code < 300 || code > 399 {
+			return nil, fmt.Errorf("%w: код перенаправления %d", ErrInvalidLocation, code)
+		}
+
+		return redirect(cfg.Redirect, code), nil
+	case HandlerProxy:
+		prefix := ""
+		if cfg.Match == MatchPrefix {
+			prefix = cfg.Path
+		}
+
+		pc := proxy.Config{Prefix: prefix}
+
+		if cfg.ProxyPass != "" {
+			pc.Upstreams = append(pc.Upstreams, cfg.ProxyPass)
+		}
+
+		if p := cfg.Proxy; p != nil {
+			pc.Upstreams = append(pc.Upstreams, p.Upstreams...)
+			pc.Balance = p.Balance
+			pc.MaxFails = p.MaxFails
+			pc.FailTimeout = time.Duration(p.FailTimeout)
+			pc.ConnectTimeout = time.Duration(p.ConnectTimeout)
+			pc.ReadTimeout = time.Duration(p.ReadTimeout)
+		}
+
+		return proxy.New(pc)
+	default:
+		return nil, fmt.Errorf("%w: неизвестный обработчик %q", ErrInvalidLocation, cfg.Handler)
+	}
+}
+
+// каталог с файлами location: root или alias поверх параметров сервера
+func (l *Location) files(base static.Config) (static.Config, error) {
+	cfg := l.cfg
+	s := base
+
+	if cfg.Root != "" && cfg.Alias != "" {
+		return s, fmt.Errorf("%w: root и alias заданы одновременно", ErrInvalidLocation)
+	}
+
+	if cfg.Root != "" {
+		s.Root = cfg.Root
+	}
+
+	if cfg.Alias != "" {
+		// в регулярном выражении нет префикса, который можно заменить
+		if cfg.Match == MatchRegex {
+			return s, fmt.Errorf("%w: alias не поддерживается для регулярных выражений", ErrInvalidLocation)
+		}
+
+		s.Root = cfg.Alias
+		s.Prefix = strings.TrimSuffix(cfg.Path, "/")
+	}
+
+	return s, nil
+}
+
+// заголовки, добавляемые к ответам location: заданные явно и Cache-Control из политики кеширования
+func (l *Location) responseHeaders() map[string]string {
+	headers := make(map[string]string, len(l.cfg.Headers)+1)
+
+	for k, v := range l.cfg.Headers {
+		headers[k] = v
+	}
+
+	if c := l.cfg.Cache; c != nil {
+		switch {
+		case c.NoStore:
+			headers["Cache-Control"] = "no-store"
+		case c.MaxAge > 0:
+			headers["Cache-Control"] = "max-age=" + strconv.FormatInt(int64(time.Duration(c.MaxAge).Seconds()), 10)
+		}
+	}
+
+	return headers
+}
+
+// обработчик, добавляющий заголовки к ответу
+func withHeaders(next handler.Handler, headers map[string]string) handler.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+
+	return handler.HandlerFunc(func(w handler.ResponseWriter, r *handler.Request) {
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// обработчик, перенаправляющий клиента на target
+func redirect(target string, code int) handler.Handler {
+	return handler.HandlerFunc(func(w handler.ResponseWriter, r *handler.Request) {
+		location := strings.ReplaceAll(target, "$request_uri", r.RequestURI())
+
+		w.Header().Set("Location", location)
+		w.WriteHeader(code)
+
+		r.Log().Infof("клиент перенаправлен на %q", location)
+	})
+}
@@ -2,68 +2,253 @@
 package log
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Kostushka/tcp_server/internal/rotate"
+)
+
+const (
+	// FormatText - лог в виде строк key=value
+	FormatText = "text"
+	// FormatJSON - лог в виде JSON-объектов, по одному на строку
+	FormatJSON = "json"
+)
+
+var (
+	// ErrInvalidLevel - указан неизвестный уровень логирования
+	ErrInvalidLevel = errors.New("неизвестный уровень логирования")
+	// ErrInvalidFormat - указан неизвестный формат лога
+	ErrInvalidFormat = errors.New("неизвестный формат лога")
 )
 
-var infoLog *log.Logger
-var errorLog *log.Logger
+// Config - параметры логирования
+type Config struct {
+	// File - файл для записи лога, пустая строка - вывод в stdout и stderr
+	File string
+	// Level - минимальный уровень: debug, info, warn или error
+	Level string
+	// Format - формат лога: text или json
+	Format string
+	// Rotate - параметры ротации файла лога
+	Rotate rotate.Config
+}
+
+// Logger - логер с набором атрибутов, добавляемых к каждой строке лога
+type Logger struct {
+	l *slog.Logger
+}
+
+// минимальный уровень логирования, может быть изменен во время работы сервера
+var level slog.LevelVar
+
+// логер по умолчанию: до вызова New пишет в stdout и stderr
+var std atomic.Pointer[Logger]
 
-const permissions = 0644
+func init() {
+	std.Store(&Logger{l: slog.New(newSplitHandler(os.Stdout, os.Stderr, FormatText))})
+}
+
+// New - создаем логер
+func New(cfg Config) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = FormatText
+	}
+
+	if cfg.Format != FormatText && cfg.Format != FormatJSON {
+		return fmt.Errorf("%w: %q", ErrInvalidFormat, cfg.Format)
+	}
 
-// New - создаем логеры
-func New(logFile string) error {
-	// создаем логеры, пишущие в stdout
-	if logFile == "" {
-		infoLog = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime)
-		errorLog = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime)
+	// создаем логер, пишущий в stdout и stderr
+	if cfg.File == "" {
+		std.Store(&Logger{l: slog.New(newSplitHandler(os.Stdout, os.Stderr, cfg.Format))})
 
 		return nil
 	}
-	// создаем файл для записи лога
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, permissions) //nolint:gosec
+	// создаем файл для записи лога, ротируемый по размеру и времени
+	f, err := rotate.Open(cfg.File, cfg.Rotate)
 	if err != nil {
 		return err
 	}
-	// создаем логеры, пишущие в файл
-	infoLog = log.New(f, "INFO: ", log.Ldate|log.Ltime)
-	errorLog = log.New(f, "ERROR: ", log.Ldate|log.Ltime)
+	// создаем логер, пишущий в файл
+	std.Store(&Logger{l: slog.New(newHandler(f, cfg.Format))})
 
 	return nil
 }
 
-// Infof - пишет информационный лог
-func Infof(v ...any) {
-	// строка лога без аргументов
-	if len(v) == 1 {
-		infoLog.Println(v...)
+// NewWriter - создать логер, пишущий в w в формате format; уровень общий с логером по умолчанию
+func NewWriter(w io.Writer, format string) (*Logger, error) {
+	if format == "" {
+		format = FormatText
+	}
 
-		return
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFormat, format)
 	}
-	// строка лога с аргументами
-	if r, ok := v[0].(string); ok {
-		infoLog.Printf(r, v[1:]...)
 
+	return &Logger{l: slog.New(newHandler(w, format))}, nil
+}
+
+// SetLevel - устанавливает минимальный уровень логирования: debug, info, warn или error
+func SetLevel(name string) error {
+	if name == "" {
+		name = "info"
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidLevel, name)
+	}
+
+	level.Set(l)
+
+	return nil
+}
+
+// Default - возвращает логер по умолчанию
+func Default() *Logger {
+	return std.Load()
+}
+
+// With - возвращает логер по умолчанию с атрибутами, например, данными запроса
+func With(args ...any) *Logger {
+	return Default().With(args...)
+}
+
+// With - возвращает логер с дополнительными атрибутами
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l: l.l.With(args...)}
+}
+
+// Slog - возвращает логер log/slog с теми же атрибутами, например, для встраивающих сервер программ
+func (l *Logger) Slog() *slog.Logger {
+	return l.l
+}
+
+// Debugf - пишет отладочный лог по строке формата format
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+// Infof - пишет информационный лог по строке формата format
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+// Warnf - пишет лог предупреждения по строке формата format
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+// Errorf - пишет лог ошибки по строке формата format
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+// форматируем сообщение, только если уровень включен
+func (l *Logger) logf(lvl slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !l.l.Enabled(ctx, lvl) {
 		return
 	}
 
-	errorLog.Println("некорректный формат лога")
+	l.l.Log(ctx, lvl, strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+}
+
+// Debugf - пишет отладочный лог; одно значение пишется как есть,
+// иначе первое значение - строка формата для остальных
+func Debugf(v ...any) {
+	Default().logv(slog.LevelDebug, v)
+}
+
+// Infof - пишет информационный лог; одно значение пишется как есть,
+// иначе первое значение - строка формата для остальных
+func Infof(v ...any) {
+	Default().logv(slog.LevelInfo, v)
+}
+
+// Warnf - пишет лог предупреждения; одно значение пишется как есть,
+// иначе первое значение - строка формата для остальных
+func Warnf(v ...any) {
+	Default().logv(slog.LevelWarn, v)
 }
 
-// Errorf - пишет лог ошибки
+// Errorf - пишет лог ошибки; одно значение пишется как есть,
+// иначе первое значение - строка формата для остальных
 func Errorf(v ...any) {
+	Default().logv(slog.LevelError, v)
+}
+
+// пишем лог из значений v в стиле функций пакета
+func (l *Logger) logv(lvl slog.Level, v []any) {
+	switch {
 	// строка лога без аргументов
-	if len(v) == 1 {
-		errorLog.Println(v...)
+	case len(v) == 1:
+		l.logf(lvl, "%v", v[0])
+	// строка лога с аргументами
+	case len(v) > 1:
+		if format, ok := v[0].(string); ok {
+			l.logf(lvl, format, v[1:]...)
 
-		return
+			return
+		}
+
+		fallthrough
+	default:
+		l.logf(slog.LevelError, "некорректный формат лога: %v", v)
 	}
-	// строка лога с аргументами
-	if r, ok := v[0].(string); ok {
-		errorLog.Printf(r, v[1:]...)
+}
 
-		return
+// создаем обработчик в нужном формате
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: &level}
+
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
+// splitHandler - пишет ошибки в один поток, остальные уровни - в другой
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+func newSplitHandler(out, err io.Writer, format string) *splitHandler {
+	return &splitHandler{
+		out: newHandler(out, format),
+		err: newHandler(err, format),
+	}
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return h.out.Enabled(ctx, lvl)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		return h.err.Handle(ctx, r)
 	}
 
-	errorLog.Println("некорректный формат лога")
+	return h.out.Handle(ctx, r)
+}
+
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
+}
+
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
 }
@@ -0,0 +1,581 @@
+// Package markdown - пакет, преобразующий Markdown (CommonMark и таблицы GFM) в HTML
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// виды блоков документа
+const (
+	blockParagraph = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockList
+	blockItem
+	blockRule
+	blockTable
+)
+
+// блок документа
+type block struct {
+	kind int
+	// text - текст абзаца, заголовка или содержимое блока кода
+	text string
+	// level - уровень заголовка
+	level int
+	// lang - язык блока кода
+	lang string
+	// ordered, start, tight - параметры списка
+	ordered bool
+	start   int
+	tight   bool
+	// children - вложенные блоки цитаты, списка и пункта списка
+	children []*block
+	// align, rows - выравнивание столбцов и ячейки таблицы, первая строка - заголовок
+	align []string
+	rows  [][]string
+}
+
+// ссылка, заданная определением [label]: url "title"
+type reference struct {
+	url   string
+	title string
+}
+
+// парсер документа
+type parser struct {
+	refs map[string]reference
+}
+
+var (
+	atxHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematic     = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceOpen    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*?)[ \t]*$")
+	setextLine   = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	listMarker   = regexp.MustCompile(`^( {0,3})([-+*]|\d{1,9}[.)])([ \t]+|$)`)
+	refDef       = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*<?([^\s>]+)>?(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*$`)
+	tableDelimit = regexp.MustCompile(`^ *\|? *:?-+:? *(\| *:?-+:? *)*\|? *$`)
+)
+
+// разобрать строки в последовательность блоков
+func (p *parser) parse(lines []string) []*block {
+	var blocks []*block
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			i++
+		case fenceOpen.MatchString(line):
+			var b *block
+
+			b, i = parseFence(lines, i)
+			blocks = append(blocks, b)
+		case indent(line) >= 4:
+			var b *block
+
+			b, i = parseIndentedCode(lines, i)
+			blocks = append(blocks, b)
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			blocks = append(blocks, &block{kind: blockHeading, level: len(m[1]), text: m[2]})
+			i++
+		case thematic.MatchString(line):
+			blocks = append(blocks, &block{kind: blockRule})
+			i++
+		case isQuote(line):
+			var b *block
+
+			b, i = p.parseQuote(lines, i)
+			blocks = append(blocks, b)
+		case listMarker.MatchString(line):
+			var b *block
+
+			b, i = p.parseList(lines, i)
+			blocks = append(blocks, b)
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableDelimit.MatchString(lines[i+1]) &&
+			len(splitRow(line)) == len(splitRow(lines[i+1])):
+			var b *block
+
+			b, i = parseTable(lines, i)
+			blocks = append(blocks, b)
+		case refDef.MatchString(line):
+			m := refDef.FindStringSubmatch(line)
+			label := normalizeLabel(m[1])
+
+			// первое определение ссылки с этой меткой важнее следующих
+			if _, ok := p.refs[label]; !ok {
+				p.refs[label] = reference{url: m[2], title: m[3] + m[4] + m[5]}
+			}
+
+			i++
+		default:
+			var b *block
+
+			b, i = parseParagraph(lines, i)
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
+
+// блок кода, ограниченный ``` или ~~~
+func parseFence(lines []string, i int) (*block, int) {
+	m := fenceOpen.FindStringSubmatch(lines[i])
+	pad, fence := len(m[1]), m[2]
+	lang, _, _ := strings.Cut(m[3], " ")
+
+	var code []string
+
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if indent(lines[i]) < 4 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+
+			break
+		}
+
+		// отступ открывающей строки убирается и из содержимого
+		code = append(code, trimIndent(lines[i], pad))
+	}
+
+	return &block{kind: blockCode, lang: lang, text: joinLines(code)}, i
+}
+
+// блок кода с отступом в четыре пробела
+func parseIndentedCode(lines []string, i int) (*block, int) {
+	var code []string
+
+	for ; i < len(lines) && (isBlank(lines[i]) || indent(lines[i]) >= 4); i++ {
+		code = append(code, trimIndent(lines[i], 4))
+	}
+
+	// пустые строки в конце не относятся к блоку кода
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+
+	return &block{kind: blockCode, text: joinLines(code)}, i
+}
+
+// цитата: строки с '>' и продолжающие абзац строки без него
+func (p *parser) parseQuote(lines []string, i int) (*block, int) {
+	var inner []string
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+
+		if isQuote(line) {
+			line = strings.TrimLeft(line, " ")[1:]
+			line = strings.TrimPrefix(line, " ")
+			inner = append(inner, line)
+
+			continue
+		}
+
+		// ленивое продолжение абзаца цитаты
+		if !isBlank(line) && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !startsBlock(line) {
+			inner = append(inner, line)
+
+			continue
+		}
+
+		break
+	}
+
+	return &block{kind: blockQuote, children: p.parse(inner)}, i
+}
+
+// маркер пункта списка
+type marker struct {
+	ordered bool
+	// delim - '-', '+', '*' для маркированного списка, '.' или ')' для нумерованного
+	delim byte
+	start int
+	// offset - отступ содержимого пункта
+	offset int
+}
+
+// разобрать маркер пункта списка в начале строки
+func parseMarker(line string) (marker, bool) {
+	m := listMarker.FindStringSubmatch(line)
+	if m == nil {
+		return marker{}, false
+	}
+
+	mk := marker{offset: len(m[1]) + len(m[2]) + len(m[3])}
+
+	// содержимое с отступом больше четырех пробелов - блок кода внутри пункта
+	if spaces := len(m[3]); spaces > 4 {
+		mk.offset = len(m[1]) + len(m[2]) + 1
+	} else if spaces == 0 {
+		mk.offset++
+	}
+
+	if d := m[2][len(m[2])-1]; d == '.' || d == ')' {
+		mk.ordered, mk.delim = true, d
+		mk.start, _ = strconv.Atoi(m[2][:len(m[2])-1]) //nolint:errcheck
+	} else {
+		mk.delim = d
+	}
+
+	return mk, true
+}
+
+// список: пункты с маркерами одного вида
+func (p *parser) parseList(lines []string, i int) (*block, int) {
+	first, _ := parseMarker(lines[i])
+	list := &block{kind: blockList, ordered: first.ordered, start: first.start, tight: true}
+
+	for i < len(lines) {
+		mk, ok := parseMarker(lines[i])
+		if !ok || mk.ordered != first.ordered || mk.delim != first.delim || thematic.MatchString(lines[i]) {
+			break
+		}
+
+		head := expandTabs(lines[i])
+		inner := []string{head[min(mk.offset, len(head)):]}
+		i++
+
+		for ; i < len(lines); i++ {
+			line := expandTabs(lines[i])
+
+			switch {
+			case isBlank(line):
+				inner = append(inner, "")
+
+				continue
+			case indent(line) >= mk.offset:
+				inner = append(inner, line[mk.offset:])
+
+				continue
+			case !isBlank(inner[len(inner)-1]) && !startsBlock(line):
+				// ленивое продолжение абзаца
+				inner = append(inner, line)
+
+				continue
+			}
+
+			break
+		}
+
+		// пустые строки между пунктами делают список "свободным": пункты оборачиваются в <p>
+		trailing := 0
+		for len(inner) > 0 && isBlank(inner[len(inner)-1]) {
+			inner = inner[:len(inner)-1]
+			trailing++
+		}
+
+		item := &block{kind: blockItem, children: p.parse(inner)}
+		list.children = append(list.children, item)
+
+		if hasInnerBlank(inner) && len(item.children) > 1 {
+			list.tight = false
+		}
+
+		if trailing > 0 && i < len(lines) {
+			if next, ok := parseMarker(lines[i]); ok && next.delim == first.delim {
+				list.tight = false
+			} else {
+				break
+			}
+		}
+	}
+
+	return list, i
+}
+
+// таблица GFM: строка заголовка, строка выравнивания и строки данных
+func parseTable(lines []string, i int) (*block, int) {
+	t := &block{kind: blockTable}
+
+	header := splitRow(lines[i])
+	for _, cell := range splitRow(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			t.align = append(t.align, "center")
+		case strings.HasSuffix(cell, ":"):
+			t.align = append(t.align, "right")
+		case strings.HasPrefix(cell, ":"):
+			t.align = append(t.align, "left")
+		default:
+			t.align = append(t.align, "")
+		}
+	}
+
+	t.rows = append(t.rows, header)
+
+	for i += 2; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+		row := splitRow(lines[i])
+
+		// лишние ячейки отбрасываются, недостающие остаются пустыми
+		cells := make([]string, len(header))
+		copy(cells, row)
+		t.rows = append(t.rows, cells)
+	}
+
+	return t, i
+}
+
+// разделить строку таблицы на ячейки по '|', кроме экранированных
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+
+	for j := 0; j < len(line); j++ {
+		switch {
+		case line[j] == '\\' && j+1 < len(line) && line[j+1] == '|':
+			cell.WriteByte('|')
+			j++
+		case line[j] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[j])
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// абзац; строка "===" или "---" после него делает его заголовком
+func parseParagraph(lines []string, i int) (*block, int) {
+	var text []string
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+
+		if len(text) > 0 {
+			if m := setextLine.FindStringSubmatch(line); m != nil {
+				level := 2
+				if m[1][0] == '=' {
+					level = 1
+				}
+
+				return &block{kind: blockHeading, level: level, text: strings.Join(text, "\n")}, i + 1
+			}
+		}
+
+		if isBlank(line) || (len(text) > 0 && interruptsParagraph(line)) {
+			break
+		}
+
+		text = append(text, strings.TrimLeft(line, " \t"))
+	}
+
+	return &block{kind: blockParagraph, text: strings.Join(text, "\n")}, i
+}
+
+// может ли строка прервать абзац
+func interruptsParagraph(line string) bool {
+	if !startsBlock(line) {
+		return false
+	}
+
+	// нумерованный список прерывает абзац, только если начинается с 1, пустой пункт - никогда
+	if mk, ok := parseMarker(line); ok {
+		rest := strings.TrimSpace(line[min(mk.offset, len(line)):])
+
+		return rest != "" && (!mk.ordered || mk.start == 1)
+	}
+
+	return true
+}
+
+// начинает ли строка новый блок
+func startsBlock(line string) bool {
+	return atxHeading.MatchString(line) || thematic.MatchString(line) || fenceOpen.MatchString(line) ||
+		isQuote(line) || listMarker.MatchString(line)
+}
+
+// есть ли пустая строка между непустыми
+func hasInnerBlank(lines []string) bool {
+	for j := 1; j < len(lines)-1; j++ {
+		if isBlank(lines[j]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isQuote(line string) bool {
+	return indent(line) < 4 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// отступ строки в пробелах; табуляция - до следующей позиции, кратной 4
+func indent(line string) int {
+	n := 0
+
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+
+	return n
+}
+
+// заменить табуляции в отступе пробелами
+func expandTabs(line string) string {
+	n := indent(line)
+	rest := strings.TrimLeft(line, " \t")
+
+	return strings.Repeat(" ", n) + rest
+}
+
+// убрать из начала строки до n пробелов отступа
+func trimIndent(line string, n int) string {
+	line = expandTabs(line)
+
+	return line[min(n, indent(line)):]
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// метки ссылок сравниваются без учета регистра и лишних пробелов
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// отрисовать блоки в HTML; tight - абзацы пунктов "плотного" списка выводятся без <p>
+func (p *parser) render(b *strings.Builder, blocks []*block, tight bool) {
+	for _, bl := range blocks {
+		switch bl.kind {
+		case blockParagraph:
+			if tight {
+				b.WriteString(p.inline(bl.text))
+			} else {
+				b.WriteString("<p>" + p.inline(bl.text) + "</p>\n")
+			}
+		case blockHeading:
+			n := strconv.Itoa(bl.level)
+			b.WriteString("<h" + n + ">" + p.inline(bl.text) + "</h" + n + ">\n")
+		case blockCode:
+			if bl.lang != "" {
+				b.WriteString(`<pre><code class="language-` + html.EscapeString(bl.lang) + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+
+			b.WriteString(html.EscapeString(bl.text) + "</code></pre>\n")
+		case blockRule:
+			b.WriteString("<hr>\n")
+		case blockQuote:
+			b.WriteString("<blockquote>\n")
+			p.render(b, bl.children, false)
+			b.WriteString("</blockquote>\n")
+		case blockList:
+			p.renderList(b, bl)
+		case blockTable:
+			p.renderTable(b, bl)
+		}
+	}
+}
+
+func (p *parser) renderList(b *strings.Builder, list *block) {
+	tag := "ul"
+
+	switch {
+	case list.ordered && list.start != 1:
+		tag = "ol"
+		b.WriteString(`<ol start="` + strconv.Itoa(list.start) + `">` + "\n")
+	case list.ordered:
+		tag = "ol"
+		b.WriteString("<ol>\n")
+	default:
+		b.WriteString("<ul>\n")
+	}
+
+	for _, item := range list.children {
+		b.WriteString("<li>")
+
+		// в "плотном" списке блоки после текста пункта начинаются с новой строки
+		if !list.tight || (len(item.children) > 0 && item.children[0].kind != blockParagraph) {
+			b.WriteString("\n")
+		}
+
+		for j, child := range item.children {
+			p.render(b, []*block{child}, list.tight)
+
+			if list.tight && child.kind == blockParagraph && j < len(item.children)-1 {
+				b.WriteString("\n")
+			}
+		}
+
+		b.WriteString("</li>\n")
+	}
+
+	b.WriteString("</" + tag + ">\n")
+}
+
+func (p *parser) renderTable(b *strings.Builder, t *block) {
+	b.WriteString("<table>\n")
+
+	for r, row := range t.rows {
+		cellTag := "td"
+
+		switch r {
+		case 0:
+			cellTag = "th"
+
+			b.WriteString("<thead>\n")
+		case 1:
+			b.WriteString("<tbody>\n")
+		}
+
+		b.WriteString("<tr>\n")
+
+		for c, cell := range row {
+			b.WriteString("<" + cellTag)
+
+			if c < len(t.align) && t.align[c] != "" {
+				b.WriteString(` style="text-align: ` + t.align[c] + `"`)
+			}
+
+			b.WriteString(">" + p.inline(cell) + "</" + cellTag + ">\n")
+		}
+
+		b.WriteString("</tr>\n")
+
+		if r == 0 {
+			b.WriteString("</thead>\n")
+		}
+	}
+
+	if len(t.rows) > 1 {
+		b.WriteString("</tbody>\n")
+	}
+
+	b.WriteString("</table>\n")
+}
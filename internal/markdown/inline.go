@@ -0,0 +1,500 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	entity    = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autolink  = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	autoEmail = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*)>`)
+)
+
+// часть строки при разборе встроенных элементов: готовый HTML, серия '*' или '_' либо '[' ссылки
+type piece struct {
+	html string
+	// delim - символ серии разделителей выделения, 0 - не разделитель
+	delim byte
+	// n - сколько символов серии еще не использовано, orig - исходная длина серии
+	n, orig int
+	// canOpen, canClose - может ли серия открывать и закрывать выделение
+	canOpen, canClose bool
+	// openTags, closeTags - теги выделения, найденные для серии
+	openTags, closeTags string
+	// bracket - '[' ссылки или "![" изображения, active - внутри еще может быть ссылка
+	bracket string
+	active  bool
+}
+
+// отрисовать piece в HTML
+func (pc *piece) String() string {
+	switch {
+	case pc.delim != 0:
+		return pc.closeTags + strings.Repeat(string(pc.delim), pc.n) + pc.openTags
+	case pc.bracket != "":
+		return pc.bracket
+	default:
+		return pc.html
+	}
+}
+
+// отрисовать встроенные элементы строки: выделение, код, ссылки, изображения, переносы
+func (p *parser) inline(text string) string {
+	var pieces []*piece
+
+	// последние пробелы абзаца не выводятся
+	text = strings.TrimRight(text, " \t")
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			pieces = append(pieces, &piece{html: "<br>\n"})
+			i += 2
+		case c == '\\' && i+1 < len(text) && isPunct(text[i+1]):
+			pieces = append(pieces, &piece{html: html.EscapeString(text[i+1 : i+2])})
+			i += 2
+		case c == '`':
+			var h string
+
+			h, i = codeSpan(text, i)
+			pieces = append(pieces, &piece{html: h})
+		case c == '*' || c == '_':
+			var pc *piece
+
+			pc, i = delimRun(text, i)
+			pieces = append(pieces, pc)
+		case c == '!' && i+1 < len(text) && text[i+1] == '[':
+			pieces = append(pieces, &piece{bracket: "![", active: true})
+			i += 2
+		case c == '[':
+			pieces = append(pieces, &piece{bracket: "[", active: true})
+			i++
+		case c == ']':
+			pieces, i = p.closeBracket(pieces, text, i)
+		case c == '<':
+			if m := autolink.FindStringSubmatch(text[i:]); m != nil {
+				pieces = append(pieces, &piece{html: link(m[1], "", html.EscapeString(m[1]))})
+				i += len(m[0])
+			} else if m := autoEmail.FindStringSubmatch(text[i:]); m != nil {
+				pieces = append(pieces, &piece{html: link("mailto:"+m[1], "", html.EscapeString(m[1]))})
+				i += len(m[0])
+			} else {
+				pieces = append(pieces, &piece{html: "&lt;"})
+				i++
+			}
+		case c == '&':
+			if m := entity.FindString(text[i:]); m != "" {
+				pieces = append(pieces, &piece{html: m})
+				i += len(m)
+			} else {
+				pieces = append(pieces, &piece{html: "&amp;"})
+				i++
+			}
+		case c == '\n':
+			// два пробела в конце строки - принудительный перенос
+			if n := len(pieces); n > 0 && strings.HasSuffix(pieces[n-1].html, "  ") && pieces[n-1].delim == 0 {
+				pieces[n-1].html = strings.TrimRight(pieces[n-1].html, " ")
+				pieces = append(pieces, &piece{html: "<br>\n"})
+			} else {
+				if n > 0 && pieces[n-1].delim == 0 && pieces[n-1].bracket == "" {
+					pieces[n-1].html = strings.TrimRight(pieces[n-1].html, " ")
+				}
+
+				pieces = append(pieces, &piece{html: "\n"})
+			}
+
+			// пробелы в начале следующей строки не выводятся
+			for i++; i < len(text) && (text[i] == ' ' || text[i] == '\t'); i++ {
+			}
+		default:
+			j := i + 1
+			for j < len(text) && !strings.ContainsRune("\\`*_![]<&\n", rune(text[j])) {
+				j++
+			}
+
+			pieces = append(pieces, &piece{html: html.EscapeString(text[i:j])})
+			i = j
+		}
+	}
+
+	processEmphasis(pieces)
+
+	return join(pieces)
+}
+
+// код в обратных кавычках: закрывается серией той же длины
+func codeSpan(text string, i int) (string, int) {
+	n := 0
+	for i+n < len(text) && text[i+n] == '`' {
+		n++
+	}
+
+	fence := text[i : i+n]
+
+	for j := i + n; j < len(text); {
+		k := strings.Index(text[j:], fence)
+		if k == -1 {
+			break
+		}
+
+		k += j
+
+		// серия длиннее открывающей не закрывает код
+		end := k + n
+		if end < len(text) && text[end] == '`' {
+			for end < len(text) && text[end] == '`' {
+				end++
+			}
+
+			j = end
+
+			continue
+		}
+
+		code := strings.ReplaceAll(text[i+n:k], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+			code = code[1 : len(code)-1]
+		}
+
+		return "<code>" + html.EscapeString(code) + "</code>", end
+	}
+
+	// закрывающей серии нет - кавычки выводятся как есть
+	return fence, i + n
+}
+
+// серия '*' или '_' и правила, по которым она может открывать и закрывать выделение
+func delimRun(text string, i int) (*piece, int) {
+	c := text[i]
+	j := i
+	for j < len(text) && text[j] == c {
+		j++
+	}
+
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	if i == 0 {
+		before = ' '
+	}
+
+	after, _ := utf8.DecodeRuneInString(text[j:])
+	if j == len(text) {
+		after = ' '
+	}
+
+	left := !unicode.IsSpace(after) && (!isPunctRune(after) || unicode.IsSpace(before) || isPunctRune(before))
+	right := !unicode.IsSpace(before) && (!isPunctRune(before) || unicode.IsSpace(after) || isPunctRune(after))
+
+	pc := &piece{delim: c, n: j - i, orig: j - i, canOpen: left, canClose: right}
+
+	// '_' внутри слова не выделяет
+	if c == '_' {
+		pc.canOpen = left && (!right || isPunctRune(before))
+		pc.canClose = right && (!left || isPunctRune(after))
+	}
+
+	return pc, j
+}
+
+// найти пары разделителей и превратить их в <em> и <strong>
+func processEmphasis(pieces []*piece) {
+	for ci := 0; ci < len(pieces); ci++ {
+		closer := pieces[ci]
+		if closer.delim == 0 || !closer.canClose {
+			continue
+		}
+
+		for closer.n > 0 {
+			oi := ci - 1
+			for ; oi >= 0; oi-- {
+				op := pieces[oi]
+				if op.delim != closer.delim || !op.canOpen || op.n == 0 {
+					continue
+				}
+
+				// правило трех: серия, которая может и открывать, и закрывать, не сочетается
+				// с серией, если сумма их длин кратна трем
+				if (op.canClose || closer.canOpen) && (op.orig+closer.orig)%3 == 0 &&
+					(op.orig%3 != 0 || closer.orig%3 != 0) {
+					continue
+				}
+
+				break
+			}
+
+			if oi < 0 {
+				break
+			}
+
+			opener := pieces[oi]
+
+			use, tag := 1, "em"
+			if opener.n >= 2 && closer.n >= 2 {
+				use, tag = 2, "strong"
+			}
+
+			opener.n -= use
+			closer.n -= use
+			opener.openTags = "<" + tag + ">" + opener.openTags
+			closer.closeTags += "</" + tag + ">"
+
+			// разделители между парой уже не могут образовать выделение с внешними
+			for k := oi + 1; k < ci; k++ {
+				if pieces[k].delim != 0 {
+					pieces[k].canOpen, pieces[k].canClose = false, false
+				}
+			}
+		}
+	}
+}
+
+// ']' закрывает ссылку или изображение, если после него адрес или известная метка
+func (p *parser) closeBracket(pieces []*piece, text string, i int) ([]*piece, int) {
+	oi := len(pieces) - 1
+	for ; oi >= 0 && pieces[oi].bracket == ""; oi-- {
+	}
+
+	if oi < 0 || !pieces[oi].active {
+		if oi >= 0 {
+			// неактивная скобка больше не рассматривается
+			pieces[oi].bracket, pieces[oi].html = "", pieces[oi].bracket
+		}
+
+		return append(pieces, &piece{html: "]"}), i + 1
+	}
+
+	opener := pieces[oi]
+	label := textBetween(pieces, oi)
+
+	dest, title, end, ok := linkTarget(text, i+1)
+	if !ok {
+		dest, title, end, ok = p.refTarget(text, i+1, label)
+	}
+
+	if !ok {
+		opener.bracket, opener.html = "", opener.bracket
+
+		return append(pieces, &piece{html: "]"}), i + 1
+	}
+
+	inner := pieces[oi+1:]
+	processEmphasis(inner)
+
+	var h string
+
+	if opener.bracket == "![" {
+		h = `<img src="` + html.EscapeString(safeURL(dest)) + `" alt="` + html.EscapeString(plainText(join(inner))) + `"`
+		if title != "" {
+			h += ` title="` + html.EscapeString(title) + `"`
+		}
+
+		h += ">"
+	} else {
+		h = link(dest, title, join(inner))
+
+		// ссылки не вкладываются друг в друга
+		for _, pc := range pieces[:oi] {
+			if pc.bracket == "[" {
+				pc.active = false
+			}
+		}
+	}
+
+	return append(pieces[:oi], &piece{html: h}), end
+}
+
+// текст между '[' и ']' - метка ссылки
+func textBetween(pieces []*piece, oi int) string {
+	var b strings.Builder
+
+	for _, pc := range pieces[oi+1:] {
+		b.WriteString(pc.String())
+	}
+
+	return html.UnescapeString(plainText(b.String()))
+}
+
+// адрес ссылки в скобках: (url "title")
+func linkTarget(text string, i int) (string, string, int, bool) {
+	if i >= len(text) || text[i] != '(' {
+		return "", "", 0, false
+	}
+
+	i = skipSpace(text, i+1)
+
+	var dest string
+
+	if i < len(text) && text[i] == '<' {
+		end := strings.IndexAny(text[i+1:], ">\n")
+		if end == -1 || text[i+1+end] != '>' {
+			return "", "", 0, false
+		}
+
+		dest = text[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		depth, start := 0, i
+
+		for ; i < len(text); i++ {
+			c := text[i]
+			if c == '\\' && i+1 < len(text) && isPunct(text[i+1]) {
+				i++
+
+				continue
+			}
+
+			if c == ' ' || c == '\t' || c == '\n' || (c == ')' && depth == 0) {
+				break
+			}
+
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+
+		dest = unescape(text[start:i])
+	}
+
+	j := skipSpace(text, i)
+
+	var title string
+
+	if j > i && j < len(text) && strings.IndexByte(`"'(`, text[j]) != -1 {
+		closeCh := text[j]
+		if closeCh == '(' {
+			closeCh = ')'
+		}
+
+		end := strings.IndexByte(text[j+1:], closeCh)
+		if end == -1 {
+			return "", "", 0, false
+		}
+
+		title = unescape(text[j+1 : j+1+end])
+		j = skipSpace(text, j+end+2)
+	}
+
+	if j >= len(text) || text[j] != ')' {
+		return "", "", 0, false
+	}
+
+	return dest, title, j + 1, true
+}
+
+// адрес ссылки по метке: [text][label], [label][] или просто [label]
+func (p *parser) refTarget(text string, i int, label string) (string, string, int, bool) {
+	end := i
+
+	if i < len(text) && text[i] == '[' {
+		if k := strings.IndexByte(text[i+1:], ']'); k != -1 {
+			if explicit := text[i+1 : i+1+k]; strings.TrimSpace(explicit) != "" {
+				label = explicit
+			}
+
+			end = i + k + 2
+		}
+	}
+
+	ref, ok := p.refs[normalizeLabel(label)]
+	if !ok {
+		return "", "", 0, false
+	}
+
+	return ref.url, ref.title, end, true
+}
+
+// HTML ссылки; адреса со схемами, которые могут выполнить код, заменяются на "#"
+func link(dest, title, content string) string {
+	h := `<a href="` + html.EscapeString(safeURL(dest)) + `"`
+	if title != "" {
+		h += ` title="` + html.EscapeString(title) + `"`
+	}
+
+	return h + ">" + content + "</a>"
+}
+
+// адрес без опасной схемы: javascript:, vbscript:, data: и т.п.
+func safeURL(dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "#"
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto", "ftp", "tel":
+		return dest
+	default:
+		return "#"
+	}
+}
+
+// текст без тегов - для alt изображения
+func plainText(h string) string {
+	var b strings.Builder
+
+	inTag := false
+
+	for _, c := range h {
+		switch {
+		case c == '<':
+			inTag = true
+		case c == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+func join(pieces []*piece) string {
+	var b strings.Builder
+
+	for _, pc := range pieces {
+		b.WriteString(pc.String())
+	}
+
+	return b.String()
+}
+
+// убрать экранирование '\' перед знаками препинания
+func unescape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return html.UnescapeString(b.String())
+}
+
+func skipSpace(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\n') {
+		i++
+	}
+
+	return i
+}
+
+// знак препинания ASCII, который можно экранировать '\'
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+func isPunctRune(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
@@ -0,0 +1,144 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// максимальное количество страниц в кеше
+const maxCached = 256
+
+// ToHTML - преобразовать документ Markdown в HTML
+func ToHTML(src []byte) string {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\x00", "�")
+
+	p := &parser{refs: make(map[string]reference)}
+	blocks := p.parse(strings.Split(text, "\n"))
+
+	var b strings.Builder
+
+	p.render(&b, blocks, false)
+
+	return b.String()
+}
+
+// Page - данные страницы для шаблона
+type Page struct {
+	// Title - текст первого заголовка документа или имя файла
+	Title string
+	// Path - путь запроса
+	Path string
+	// Content - документ в HTML
+	Content template.HTML
+}
+
+// сохраненная страница и время изменения файла, из которого она получена
+type entry struct {
+	modTime time.Time
+	size    int64
+	page    []byte
+}
+
+// Renderer - отрисовывает файлы Markdown в страницы по шаблону; готовые страницы хранятся,
+// пока не изменится время изменения или размер файла
+type Renderer struct {
+	template atomic.Pointer[template.Template]
+
+	mu    sync.Mutex
+	cache map[string]entry
+}
+
+// New - создать Renderer с шаблоном страницы t
+func New(t *template.Template) *Renderer {
+	r := &Renderer{cache: make(map[string]entry)}
+	r.template.Store(t)
+
+	return r
+}
+
+// LoadTemplate - загрузить шаблон страницы из файла
+func LoadTemplate(path string) (*template.Template, error) {
+	t, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить шаблон страницы Markdown %q: %w", path, err)
+	}
+
+	return t, nil
+}
+
+// SetTemplate - заменить шаблон страницы; сохраненные страницы сбрасываются
+func (r *Renderer) SetTemplate(t *template.Template) {
+	r.template.Store(t)
+
+	r.mu.Lock()
+	r.cache = make(map[string]entry)
+	r.mu.Unlock()
+}
+
+// Render - страница для файла path с данными fi; содержимое читается из f, только если
+// страницы нет в кеше или файл изменился. cached - страница взята из кеша
+func (r *Renderer) Render(path, urlPath string, fi os.FileInfo, f io.Reader) (page []byte, cached bool, err error) {
+	r.mu.Lock()
+	e, ok := r.cache[path]
+	r.mu.Unlock()
+
+	if ok && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		return e.page, true, nil
+	}
+
+	src, err := io.ReadAll(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("файл %q не прочитан: %w", path, err)
+	}
+
+	content := ToHTML(src)
+
+	var buf bytes.Buffer
+
+	err = r.template.Load().Execute(&buf, Page{
+		Title:   title(content, filepath.Base(path)),
+		Path:    urlPath,
+		Content: template.HTML(content), //nolint:gosec
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("не удалось отрисовать страницу %q по шаблону: %w", path, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// кеш ограничен: при переполнении сбрасывается целиком
+	if len(r.cache) >= maxCached {
+		r.cache = make(map[string]entry)
+	}
+
+	r.cache[path] = entry{modTime: fi.ModTime(), size: fi.Size(), page: buf.Bytes()}
+
+	return buf.Bytes(), false, nil
+}
+
+var firstHeading = regexp.MustCompile(`<h1>(.*?)</h1>`)
+
+// заголовок страницы: текст первого заголовка первого уровня
+func title(content, fallback string) string {
+	m := firstHeading.FindStringSubmatch(content)
+	if m == nil {
+		return fallback
+	}
+
+	if t := strings.TrimSpace(plainText(m[1])); t != "" {
+		return t
+	}
+
+	return fallback
+}
@@ -0,0 +1,270 @@
+// Package metrics - пакет со счетчиками работы сервера в текстовом формате Prometheus
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// границы корзин гистограммы времени обработки запросов в секундах
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// методы, которые попадают в метки как есть; остальные - как OTHER, чтобы клиент не раздувал число серий
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"OPTIONS": true, "PATCH": true, "CONNECT": true, "TRACE": true,
+}
+
+// ключ счетчика запросов
+type requestKey struct {
+	method string
+	status int
+}
+
+// метрика, значение которой вычисляется при каждом запросе /metrics
+type funcMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func() float64
+}
+
+// Metrics - счетчики работы сервера
+type Metrics struct {
+	start time.Time
+
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	// гистограмма времени обработки: количество запросов в каждой корзине, сумма и общее количество
+	latencyCounts []uint64
+	latencySum    float64
+	latencyTotal  uint64
+	funcs         []funcMetric
+
+	bytesSent    atomic.Uint64
+	activeConns  atomic.Int64
+	connections  atomic.Uint64
+	acceptErrors atomic.Uint64
+}
+
+// New - создать счетчики
+func New() *Metrics {
+	return &Metrics{
+		start:         time.Now(),
+		requests:      make(map[requestKey]uint64),
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// ConnOpened - принято клиентское соединение
+func (m *Metrics) ConnOpened() {
+	m.connections.Add(1)
+	m.activeConns.Add(1)
+}
+
+// ConnClosed - клиентское соединение закрыто
+func (m *Metrics) ConnClosed() {
+	m.activeConns.Add(-1)
+}
+
+// AcceptError - ошибка при приеме соединения
+func (m *Metrics) AcceptError() {
+	m.acceptErrors.Add(1)
+}
+
+// ObserveRequest - учесть завершенный запрос
+func (m *Metrics) ObserveRequest(method string, status int, bytes int64, duration time.Duration) {
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+
+	m.bytesSent.Add(uint64(max(bytes, 0)))
+
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, status: status}]++
+
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			m.latencyCounts[i]++
+		}
+	}
+
+	m.latencySum += seconds
+	m.latencyTotal++
+}
+
+// CounterFunc - зарегистрировать счетчик, значение которого берется из функции
+func (m *Metrics) CounterFunc(name, help string, value func() float64) {
+	m.addFunc(funcMetric{name: name, help: help, typ: "counter", value: value})
+}
+
+// GaugeFunc - зарегистрировать текущее значение, которое берется из функции
+func (m *Metrics) GaugeFunc(name, help string, value func() float64) {
+	m.addFunc(funcMetric{name: name, help: help, typ: "gauge", value: value})
+}
+
+func (m *Metrics) addFunc(f funcMetric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.funcs = append(m.funcs, f)
+}
+
+// ActiveConns - возвращает количество открытых соединений
+func (m *Metrics) ActiveConns() int64 {
+	return m.activeConns.Load()
+}
+
+// Connections - возвращает количество принятых соединений
+func (m *Metrics) Connections() uint64 {
+	return m.connections.Load()
+}
+
+// Requests - возвращает количество обработанных запросов
+func (m *Metrics) Requests() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.latencyTotal
+}
+
+// BytesSent - возвращает количество байт, отправленных клиентам
+func (m *Metrics) BytesSent() uint64 {
+	return m.bytesSent.Load()
+}
+
+// Handler - обработчик, отдающий метрики в текстовом формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		if err := m.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Write - записать все метрики в текстовом формате Prometheus
+func (m *Metrics) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	m.writeRequests(bw)
+
+	writeMetric(bw, "tcp_server_response_bytes_total", "Bytes of response bodies sent to clients.", "counter",
+		float64(m.bytesSent.Load()))
+	writeMetric(bw, "tcp_server_active_connections", "Client connections currently open.", "gauge",
+		float64(m.activeConns.Load()))
+	writeMetric(bw, "tcp_server_connections_total", "Client connections accepted.", "counter",
+		float64(m.connections.Load()))
+	writeMetric(bw, "tcp_server_accept_errors_total", "Errors while accepting client connections.", "counter",
+		float64(m.acceptErrors.Load()))
+	writeMetric(bw, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge",
+		float64(m.start.UnixNano())/float64(time.Second))
+
+	m.mu.Lock()
+	funcs := append([]funcMetric(nil), m.funcs...)
+	m.mu.Unlock()
+
+	for _, f := range funcs {
+		writeMetric(bw, f.name, f.help, f.typ, f.value())
+	}
+
+	writeRuntime(bw)
+
+	return bw.Flush()
+}
+
+// счетчик запросов по методам и статусам и гистограмма времени обработки
+func (m *Metrics) writeRequests(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+
+		return keys[i].status < keys[j].status
+	})
+
+	const requests = "tcp_server_requests_total"
+
+	writeHeader(w, requests, "Requests processed, by method and status code.", "counter")
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{method=%q,status=\"%d\"} %d\n", requests, k.method, k.status, m.requests[k])
+	}
+
+	const latency = "tcp_server_request_duration_seconds"
+
+	writeHeader(w, latency, "Time spent processing a request.", "histogram")
+
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", latency, formatFloat(le), m.latencyCounts[i])
+	}
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", latency, m.latencyTotal)
+	fmt.Fprintf(w, "%s_sum %s\n", latency, formatFloat(m.latencySum))
+	fmt.Fprintf(w, "%s_count %d\n", latency, m.latencyTotal)
+}
+
+// метрики среды выполнения Go
+func writeRuntime(w io.Writer) {
+	var ms runtime.MemStats
+
+	runtime.ReadMemStats(&ms)
+
+	writeMetric(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge",
+		float64(runtime.NumGoroutine()))
+	writeMetric(w, "go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge",
+		float64(ms.Alloc))
+	writeMetric(w, "go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge",
+		float64(ms.Sys))
+	writeMetric(w, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge",
+		float64(ms.HeapInuse))
+	writeMetric(w, "go_memstats_mallocs_total", "Total number of mallocs.", "counter",
+		float64(ms.Mallocs))
+	writeMetric(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter",
+		float64(ms.NumGC))
+	writeMetric(w, "go_gc_pause_seconds_total", "Total GC pause time in seconds.", "counter",
+		float64(ms.PauseTotalNs)/float64(time.Second))
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeMetric(w io.Writer, name, help, typ string, value float64) {
+	writeHeader(w, name, help, typ)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// число в формате Prometheus
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
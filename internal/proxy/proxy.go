@@ -0,0 +1,394 @@
+// Package proxy - пакет с обработчиком, передающим запросы вышестоящим серверам
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/requestid"
+)
+
+// способы выбора вышестоящего сервера
+const (
+	// BalanceRoundRobin - серверы выбираются по очереди
+	BalanceRoundRobin = "round_robin"
+	// BalanceLeastConn - выбирается сервер с наименьшим количеством активных запросов
+	BalanceLeastConn = "least_conn"
+)
+
+const (
+	defaultMaxFails       = 1
+	defaultFailTimeout    = 10 * time.Second
+	defaultConnectTimeout = 5 * time.Second
+	defaultReadTimeout    = 60 * time.Second
+)
+
+var (
+	// ErrInvalidUpstream - некорректный адрес вышестоящего сервера
+	ErrInvalidUpstream = errors.New("некорректный адрес вышестоящего сервера")
+	// ErrInvalidBalance - неизвестный способ выбора вышестоящего сервера
+	ErrInvalidBalance = errors.New("неизвестный способ выбора вышестоящего сервера")
+)
+
+// заголовки, которые относятся к одному соединению и не передаются дальше
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// заголовки ответа вышестоящего сервера, которые заменяются собственными заголовками сервера
+var ownHeaders = []string{"Server", "Date", "X-Request-Id"}
+
+// Config - параметры передачи запросов вышестоящим серверам
+type Config struct {
+	// Upstreams - адреса вышестоящих серверов вида http://host:port[/path];
+	// если в адресе указан путь, им заменяется начало пути запроса Prefix
+	Upstreams []string
+	Prefix    string
+	// Balance - способ выбора сервера: round_robin (по умолчанию) или least_conn
+	Balance string
+	// MaxFails - количество неудачных подряд попыток соединения, после которого сервер
+	// считается недоступным на FailTimeout; по умолчанию 1
+	MaxFails int
+	// FailTimeout - время, на которое недоступный сервер исключается из выбора, по умолчанию 10s
+	FailTimeout time.Duration
+	// ConnectTimeout - время установки соединения с сервером, по умолчанию 5s
+	ConnectTimeout time.Duration
+	// ReadTimeout - время ожидания заголовков ответа сервера, по умолчанию 60s
+	ReadTimeout time.Duration
+}
+
+// вышестоящий сервер и его состояние для балансировки и пассивной проверки доступности
+type upstream struct {
+	url *url.URL
+	// active - количество запросов, обрабатываемых сервером
+	active atomic.Int64
+
+	mu sync.Mutex
+	// fails - неудачные попытки подряд
+	fails int
+	// downUntil - до этого времени сервер не выбирается
+	downUntil time.Time
+}
+
+// Proxy - обработчик, передающий запросы вышестоящим серверам и отправляющий клиенту их ответ
+type Proxy struct {
+	cfg       Config
+	upstreams []*upstream
+	next      atomic.Uint64
+	client    *http.Client
+}
+
+// New - создать обработчик для вышестоящих серверов cfg.Upstreams
+func New(cfg Config) (*Proxy, error) {
+	if len(cfg.Upstreams) == 0 {
+		return nil, fmt.Errorf("%w: не указан ни один сервер", ErrInvalidUpstream)
+	}
+
+	switch cfg.Balance {
+	case "":
+		cfg.Balance = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceLeastConn:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidBalance, cfg.Balance)
+	}
+
+	if cfg.MaxFails <= 0 {
+		cfg.MaxFails = defaultMaxFails
+	}
+
+	if cfg.FailTimeout <= 0 {
+		cfg.FailTimeout = defaultFailTimeout
+	}
+
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaultConnectTimeout
+	}
+
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = defaultReadTimeout
+	}
+
+	p := &Proxy{cfg: cfg}
+
+	for _, addr := range cfg.Upstreams {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrInvalidUpstream, addr, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w %q: ожидается http://host:port", ErrInvalidUpstream, addr)
+		}
+
+		p.upstreams = append(p.upstreams, &upstream{url: u})
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.DialContext = (&net.Dialer{Timeout: cfg.ConnectTimeout}).DialContext
+	transport.ResponseHeaderTimeout = cfg.ReadTimeout
+
+	p.client = &http.Client{
+		Transport: transport,
+		// перенаправления вышестоящего сервера отдаем клиенту как есть
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return p, nil
+}
+
+// ServeHTTP - передать запрос вышестоящему серверу и отправить клиенту его ответ
+func (p *Proxy) ServeHTTP(w handler.ResponseWriter, r *handler.Request) {
+	// тело, переданное частями, сервер не разбирает: такой запрос ушел бы вышестоящему серверу с пустым телом
+	if te := r.Header("Transfer-Encoding"); te != "" {
+		w.WriteHeader(consts.StatusLengthRequired)
+		r.Log().Errorf("запрос с Transfer-Encoding %q не передан вышестоящему серверу: нужен Content-Length", te)
+
+		return
+	}
+
+	tried := make(map[*upstream]bool, len(p.upstreams))
+	// если хотя бы один сервер не ответил вовремя, клиент получит 504
+	timedOut := false
+
+	for {
+		u := p.pick(tried)
+		tried[u] = true
+
+		req, err := p.newRequest(r, u)
+		if err != nil {
+			w.WriteHeader(consts.StatusBadRequest)
+			r.Log().Errorf("запрос к вышестоящему серверу не сформирован: %v", err)
+
+			return
+		}
+
+		u.active.Add(1)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			u.active.Add(-1)
+			p.fail(u)
+
+			timedOut = timedOut || isTimeout(err)
+
+			// запрос без тела можно повторить на другом сервере, тело запроса уже прочитано
+			if req.ContentLength == 0 && len(tried) < len(p.upstreams) {
+				r.Log().Warnf("вышестоящий сервер %s недоступен, пробуем следующий: %v", u.url.Host, err)
+
+				continue
+			}
+
+			status := consts.StatusBadGateway
+			if timedOut {
+				status = consts.StatusGatewayTimeout
+			}
+
+			w.WriteHeader(status)
+			r.Log().Errorf("вышестоящий сервер %s недоступен: %v", u.url.Host, err)
+
+			return
+		}
+
+		p.ok(u)
+		p.send(w, r, u, resp)
+
+		return
+	}
+}
+
+// отправить клиенту ответ вышестоящего сервера
+func (p *Proxy) send(w handler.ResponseWriter, r *handler.Request, u *upstream, resp *http.Response) {
+	defer u.active.Add(-1)
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+
+	removeHopHeaders(w.Header())
+	// эти заголовки сервер всегда пишет сам
+	for _, name := range ownHeaders {
+		w.Header().Del(name)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	// тело ответа передаем клиенту по мере получения, не накапливая в памяти
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		r.Log().Errorf("ответ вышестоящего сервера %s передан не полностью: %v", u.url.Host, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	r.Log().Infof("клиенту передан ответ вышестоящего сервера %s: %d, %d байт", u.url.Host, resp.StatusCode, n)
+}
+
+// выбрать сервер, которому еще не передавали запрос; доступные серверы выбираются раньше недоступных,
+// если доступных не осталось - запрос все равно передается, как в nginx
+func (p *Proxy) pick(tried map[*upstream]bool) *upstream {
+	now := time.Now()
+	start := int((p.next.Add(1) - 1) % uint64(len(p.upstreams)))
+
+	var best *upstream
+
+	bestDown := true
+
+	for i := range p.upstreams {
+		u := p.upstreams[(start+i)%len(p.upstreams)]
+		if tried[u] {
+			continue
+		}
+
+		down := u.down(now)
+		if best != nil && !p.better(u, down, best, bestDown) {
+			continue
+		}
+
+		best, bestDown = u, down
+	}
+
+	return best
+}
+
+// лучше ли сервер u выбранного ранее сервера best: доступный лучше недоступного,
+// при выборе по очереди из равных остается первый, при least_conn - менее загруженный
+func (p *Proxy) better(u *upstream, down bool, best *upstream, bestDown bool) bool {
+	if down != bestDown {
+		return !down
+	}
+
+	return p.cfg.Balance == BalanceLeastConn && u.active.Load() < best.active.Load()
+}
+
+// недоступен ли сервер в момент now
+func (u *upstream) down(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return now.Before(u.downUntil)
+}
+
+// учесть неудачную попытку соединения с сервером
+func (p *Proxy) fail(u *upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails++
+	if u.fails >= p.cfg.MaxFails {
+		u.downUntil = time.Now().Add(p.cfg.FailTimeout)
+		u.fails = 0
+	}
+}
+
+// сервер ответил: сбросить счетчик неудачных попыток
+func (p *Proxy) ok(u *upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails = 0
+	u.downUntil = time.Time{}
+}
+
+// истекло ли время ожидания сервера
+func isTimeout(err error) bool {
+	var ne net.Error
+
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// сформировать запрос к вышестоящему серверу
+func (p *Proxy) newRequest(r *handler.Request, u *upstream) (*http.Request, error) {
+	target := *u.url
+	target.RawQuery = r.RawQuery()
+
+	// без пути в upstream путь запроса передается как есть
+	if u.url.Path == "" {
+		target.Path = r.Path()
+	} else {
+		target.Path = strings.TrimSuffix(u.url.Path, "/") + "/" +
+			strings.TrimPrefix(strings.TrimPrefix(r.Path(), p.cfg.Prefix), "/")
+	}
+
+	req, err := http.NewRequest(r.Method(), target.String(), r.Body())
+	if err != nil {
+		return nil, err
+	}
+
+	for name, v := range r.Headers() {
+		req.Header.Add(name, v)
+	}
+
+	removeHopHeaders(req.Header)
+	// Host берется из адреса вышестоящего сервера
+	req.Header.Del("Host")
+
+	setForwarded(req.Header, r)
+
+	if length, err := strconv.ParseInt(r.Header("Content-Length"), 10, 64); err == nil {
+		req.ContentLength = length
+	}
+
+	return req, nil
+}
+
+// добавить заголовки X-Forwarded-*: адрес клиента дописывается к цепочке прокси,
+// схема и хост - те, к которым обращался клиент. Заголовки, присланные не доверенным прокси,
+// удаляются, чтобы клиент не мог подменить свой адрес; идентификатор запроса всегда свой
+func setForwarded(h http.Header, r *handler.Request) {
+	if !r.Proxied() {
+		for name := range h {
+			if strings.HasPrefix(name, "X-Forwarded-") {
+				h.Del(name)
+			}
+		}
+
+		h.Del("Forwarded")
+	}
+
+	h.Set(requestid.Header, r.RequestID())
+
+	if ip := r.ClientIP(); ip != nil {
+		if prior := h.Get("X-Forwarded-For"); prior != "" {
+			h.Set("X-Forwarded-For", prior+", "+ip.String())
+		} else {
+			h.Set("X-Forwarded-For", ip.String())
+		}
+	}
+
+	if scheme := r.Scheme(); scheme != "" {
+		h.Set("X-Forwarded-Proto", scheme)
+	}
+
+	if host := r.Host(); host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+}
+
+// удалить заголовки, относящиеся к одному соединению, включая перечисленные в Connection
+func removeHopHeaders(h http.Header) {
+	for _, v := range strings.Split(h.Get("Connection"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			h.Del(v)
+		}
+	}
+
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/querydata"
+)
+
+// вышестоящий сервер, отвечающий своим именем и считающий полученные запросы
+type testUpstream struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+func newUpstream(t *testing.T, name string) *testUpstream {
+	t.Helper()
+
+	u := &testUpstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.requests.Add(1)
+
+		body, _ := io.ReadAll(r.Body) //nolint:errcheck
+		_, _ = io.WriteString(w, name+":"+string(body))
+	}))
+	t.Cleanup(u.Close)
+
+	return u
+}
+
+// адрес, по которому никто не принимает соединения
+func deadUpstream(t *testing.T) string {
+	t.Helper()
+
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+
+	return s.URL
+}
+
+func newProxy(t *testing.T, upstreams ...string) *Proxy {
+	t.Helper()
+
+	p, err := New(Config{Upstreams: upstreams})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// выполнить запрос через обработчик; raw - строка запроса и заголовки без завершающей пустой строки
+func serve(t *testing.T, p *Proxy, raw, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	query, err := querydata.NewParseQueryData([]byte(raw + "\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := log.NewWriter(io.Discard, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, handler.NewRequest(query, strings.NewReader(body), l, "test", ""))
+
+	return w
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b := newUpstream(t, "a"), newUpstream(t, "b")
+	p := newProxy(t, a.URL, b.URL)
+
+	var got []string
+
+	for range 4 {
+		w := serve(t, p, "GET / HTTP/1.1\r\nHost: example.com", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("статус %d, ожидался 200", w.Code)
+		}
+
+		got = append(got, w.Body.String())
+	}
+
+	if want := "a:,b:,a:,b:"; strings.Join(got, ",") != want {
+		t.Errorf("ответы %q, ожидались %q", strings.Join(got, ","), want)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	live := newUpstream(t, "live")
+	p := newProxy(t, deadUpstream(t), live.URL)
+
+	for range 3 {
+		w := serve(t, p, "GET / HTTP/1.1\r\nHost: example.com", "")
+		if w.Code != http.StatusOK || w.Body.String() != "live:" {
+			t.Fatalf("ответ %d %q, ожидался 200 от доступного сервера", w.Code, w.Body.String())
+		}
+	}
+
+	if n := live.requests.Load(); n != 3 {
+		t.Errorf("доступный сервер получил %d запросов, ожидалось 3", n)
+	}
+}
+
+func TestNoRetryWithBody(t *testing.T) {
+	live := newUpstream(t, "live")
+	// первым выбирается недоступный сервер
+	p := newProxy(t, deadUpstream(t), live.URL)
+
+	w := serve(t, p, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4", "data")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("статус %d, ожидался 502: запрос с телом не повторяется", w.Code)
+	}
+
+	if n := live.requests.Load(); n != 0 {
+		t.Errorf("запрос с телом повторно передан другому серверу %d раз", n)
+	}
+
+	// без тела запрос повторяется на доступном сервере
+	p = newProxy(t, deadUpstream(t), live.URL)
+
+	w = serve(t, p, "GET / HTTP/1.1\r\nHost: example.com", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("статус %d, ожидался 200: запрос без тела повторяется", w.Code)
+	}
+}
+
+func TestBodyForwarded(t *testing.T) {
+	u := newUpstream(t, "a")
+	p := newProxy(t, u.URL)
+
+	w := serve(t, p, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4", "data")
+	if w.Code != http.StatusOK || w.Body.String() != "a:data" {
+		t.Errorf("ответ %d %q, ожидался 200 \"a:data\"", w.Code, w.Body.String())
+	}
+}
+
+func TestChunkedRejected(t *testing.T) {
+	u := newUpstream(t, "a")
+	p := newProxy(t, u.URL)
+
+	w := serve(t, p, "POST / HTTP/1.1\r\nHost: example.com\r\ntransfer-encoding: chunked", "4\r\ndata\r\n0\r\n\r\n")
+	if w.Code != http.StatusLengthRequired {
+		t.Errorf("статус %d, ожидался 411", w.Code)
+	}
+
+	if n := u.requests.Load(); n != 0 {
+		t.Errorf("запрос с телом частями передан вышестоящему серверу %d раз", n)
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	var got http.Header
+
+	u := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(u.Close)
+
+	p := newProxy(t, u.URL)
+
+	for _, proxied := range []bool{false, true} {
+		query, err := querydata.NewParseQueryData([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n" +
+			"x-forwarded-for: 6.6.6.6\r\nForwarded: for=6.6.6.6\r\nX-Forwarded-Port: 1\r\nX-Request-ID: forged\r\n\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query.SetClient(querydata.Client{IP: net.ParseIP("192.0.2.1"), Scheme: "http", Host: "example.com", Proxied: proxied})
+
+		l, err := log.NewWriter(io.Discard, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.ServeHTTP(httptest.NewRecorder(), handler.NewRequest(query, strings.NewReader(""), l, "own-id", ""))
+
+		wantXFF := "192.0.2.1"
+		if proxied {
+			wantXFF = "6.6.6.6, 192.0.2.1"
+		}
+
+		if xff := got.Get("X-Forwarded-For"); xff != wantXFF {
+			t.Errorf("proxied=%v: X-Forwarded-For %q, ожидался %q", proxied, xff, wantXFF)
+		}
+
+		if !proxied && (got.Get("Forwarded") != "" || got.Get("X-Forwarded-Port") != "") {
+			t.Errorf("заголовки клиента переданы дальше: %v", got)
+		}
+
+		if id := got.Get("X-Request-Id"); id != "own-id" {
+			t.Errorf("proxied=%v: X-Request-ID %q, ожидался own-id", proxied, id)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package proxyproto - пакет для разбора заголовков PROXY protocol v1 (текстовый) и v2 (бинарный),
+// которыми балансировщики уровня TCP передают исходный адрес клиента
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoHeader - доверенный источник не прислал заголовок PROXY protocol
+	ErrNoHeader = errors.New("соединение не начинается с заголовка PROXY protocol")
+	// ErrInvalidHeader - некорректный заголовок PROXY protocol
+	ErrInvalidHeader = errors.New("некорректный заголовок PROXY protocol")
+)
+
+const (
+	// максимальная длина заголовка v1 вместе с \r\n
+	v1MaxLen = 107
+	// длина фиксированной части заголовка v2
+	v2HeaderLen = 16
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Listener - принимает соединения и разбирает заголовок PROXY protocol от доверенных источников
+type Listener struct {
+	net.Listener
+	// подсети, от которых принимаем заголовок; пустой список - не доверяем никому, как в realip
+	trusted []*net.IPNet
+	// время ожидания заголовка
+	timeout time.Duration
+}
+
+// NewListener - обернуть Listener
+func NewListener(l net.Listener, trusted []*net.IPNet, timeout time.Duration) *Listener {
+	return &Listener{
+		Listener: l,
+		trusted:  trusted,
+		timeout:  timeout,
+	}
+}
+
+// Accept - принять соединение; заголовок разбирается при первом обращении к соединению,
+// чтобы медленный клиент не блокировал прием других соединений
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:    conn,
+		reader:  bufio.NewReaderSize(conn, v1MaxLen),
+		enabled: l.isTrusted(conn.RemoteAddr()),
+		timeout: l.timeout,
+	}, nil
+}
+
+// доверяем ли источнику соединения
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, v := range l.trusted {
+		if v.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Conn - соединение, адреса которого берутся из заголовка PROXY protocol
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	// разбирать ли заголовок: источник доверенный
+	enabled bool
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// Read - читаем данные, следующие за заголовком
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.handshake)
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr - адрес клиента из заголовка или адрес соединения
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.handshake)
+
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr - адрес назначения из заголовка или локальный адрес соединения
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.handshake)
+
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// разбираем заголовок с ограничением времени ожидания
+func (c *Conn) handshake() {
+	if !c.enabled {
+		return
+	}
+
+	if c.timeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			c.err = err
+
+			return
+		}
+		// снимаем ограничение после разбора заголовка
+		defer func() {
+			if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+				c.err = err
+			}
+		}()
+	}
+
+	c.err = c.readHeader()
+	if c.err != nil {
+		c.err = fmt.Errorf("соединение от %v: %w", c.Conn.RemoteAddr(), c.err)
+	}
+}
+
+// определяем версию заголовка по первым байтам
+func (c *Conn) readHeader() error {
+	// сигнатура v2 длиннее префикса v1, но клиент может прислать меньше байт, если это v1
+	start, err := c.reader.Peek(len(v1Prefix))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoHeader, err)
+	}
+
+	if bytes.Equal(start, v1Prefix) {
+		return c.readV1()
+	}
+
+	sig, err := c.reader.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(sig, v2Signature) {
+		return c.readV2()
+	}
+
+	return ErrNoHeader
+}
+
+// разбираем текстовый заголовок: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func (c *Conn) readV1() error {
+	var line []byte
+
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+		}
+
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+
+		if len(line) >= v1MaxLen {
+			return fmt.Errorf("%w: слишком длинный заголовок v1", ErrInvalidHeader)
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	fields := strings.Fields(string(line))
+
+	// UNKNOWN - прокси не знает адресов клиента, используем адреса соединения
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+
+	c.remoteAddr, c.localAddr = src, dst
+
+	return nil
+}
+
+func parseV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("%w: некорректный адрес %q", ErrInvalidHeader, ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: некорректный порт %q", ErrInvalidHeader, port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// разбираем бинарный заголовок v2
+func (c *Conn) readV2() error {
+	hdr := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(c.reader, hdr); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+
+	version, command := hdr[12]>>4, hdr[12]&0x0f
+	family := hdr[13]
+	length := binary.BigEndian.Uint16(hdr[14:16])
+
+	if version != 2 {
+		return fmt.Errorf("%w: версия %d", ErrInvalidHeader, version)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+
+	// LOCAL - соединение установлено самим прокси (например, проверка работоспособности)
+	if command == 0 {
+		return nil
+	}
+
+	if command != 1 {
+		return fmt.Errorf("%w: команда %d", ErrInvalidHeader, command)
+	}
+
+	const (
+		tcp4 = 0x11
+		tcp6 = 0x21
+	)
+
+	var ipLen int
+
+	switch family {
+	case tcp4:
+		ipLen = net.IPv4len
+	case tcp6:
+		ipLen = net.IPv6len
+	default:
+		// UDP, unix-сокеты и неизвестные семейства: адреса не используем, TLV пропускаем
+		return nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return fmt.Errorf("%w: недостаточная длина адресов", ErrInvalidHeader)
+	}
+
+	c.remoteAddr = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	c.localAddr = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+
+	return nil
+}
@@ -2,25 +2,75 @@
 package querydata
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"net"
+	"net/textproto"
 	"net/url"
+	"path"
 	"strings"
 )
 
 const defaultHeadersNumber = 5
 const parseQueryStrNumber = 3
 
+// Client - данные клиента, определенные с учетом доверенных прокси
+type Client struct {
+	// IP - адрес клиента, nil - прокси передал не IP-адрес (например, "unknown")
+	IP net.IP
+	// Addr - адрес клиента в том виде, в котором он попадает в лог
+	Addr string
+	// Scheme - схема запроса клиента: http или https
+	Scheme string
+	// Host - хост, к которому обращался клиент
+	Host string
+	// Proxied - запрос пришел от доверенного прокси, заголовки X-Forwarded-* и Forwarded учтены
+	Proxied bool
+}
+
 // QueryData - данные запроса
 type QueryData struct {
 	data []byte
 	*queryString
 	parsedReqHeaders requestHeaders
+	client           Client
 }
 
-// Header - возвращает значение заголовка по ключу
+// Header - возвращает значение заголовка по ключу без учета регистра
 func (q *QueryData) Header(key string) string {
-	return q.parsedReqHeaders[key]
+	return q.parsedReqHeaders[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// Headers - возвращает копию всех заголовков запроса с именами в каноническом виде (Content-Length)
+func (q *QueryData) Headers() map[string]string {
+	headers := make(map[string]string, len(q.parsedReqHeaders))
+	for k, v := range q.parsedReqHeaders {
+		headers[k] = v
+	}
+
+	return headers
+}
+
+// Body - возвращает начало тела запроса, прочитанное вместе с заголовками
+func (q *QueryData) Body() []byte {
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if i := bytes.Index(q.data, []byte(sep)); i != -1 {
+			return q.data[i+len(sep):]
+		}
+	}
+
+	return nil
+}
+
+// Client - возвращает данные клиента
+func (q *QueryData) Client() Client {
+	return q.client
+}
+
+// SetClient - сохраняет данные клиента, определенные с учетом доверенных прокси
+func (q *QueryData) SetClient(client Client) {
+	q.client = client
 }
 
 // ErrInvalidHTTPReq - ошибка, обозначающая некорректный формат строки запроса
@@ -31,9 +81,15 @@ var ErrInvalidHTTPHead = errors.New("incorrect header format: not HTTP")
 
 // структура с содержимым строки запроса
 type queryString struct {
-	method   string
-	path     string
-	protocol string
+	method     string
+	path       string
+	rawQuery   string
+	requestURI string
+	protocol   string
+	// путь и параметры из строки запроса до перезаписи
+	origPath     string
+	origRawQuery string
+	rewritten    bool
 }
 
 func (q *queryString) Method() string {
@@ -46,6 +102,53 @@ func (q *queryString) Protocol() string {
 	return q.protocol
 }
 
+// RequestURI - возвращает цель запроса из строки запроса без изменений
+func (q *queryString) RequestURI() string {
+	return q.requestURI
+}
+
+// RawQuery - возвращает строку параметров запроса (после '?') без декодирования
+func (q *queryString) RawQuery() string {
+	return q.rawQuery
+}
+
+// Rewrite - заменяет путь и параметры запроса при внутренней перезаписи;
+// исходные значения остаются доступны через OriginalPath и OriginalRawQuery
+func (q *queryString) Rewrite(path, rawQuery string) {
+	if !q.rewritten {
+		q.origPath, q.origRawQuery, q.rewritten = q.path, q.rawQuery, true
+	}
+
+	q.path = path
+	q.rawQuery = rawQuery
+}
+
+// OriginalPath - возвращает путь из строки запроса до перезаписи
+func (q *queryString) OriginalPath() string {
+	if q.rewritten {
+		return q.origPath
+	}
+
+	return q.path
+}
+
+// OriginalRawQuery - возвращает параметры из строки запроса до перезаписи
+func (q *queryString) OriginalRawQuery() string {
+	if q.rewritten {
+		return q.origRawQuery
+	}
+
+	return q.rawQuery
+}
+
+// Query - возвращает распарсенные параметры запроса
+func (q *queryString) Query() url.Values {
+	// некорректные параметры игнорируем, возвращаем то, что удалось распарсить
+	values, _ := url.ParseQuery(q.rawQuery) //nolint:errcheck
+
+	return values
+}
+
 // заголовки запроса
 type requestHeaders map[string]string
 
@@ -100,14 +203,20 @@ func (q *queryString) parseQueryString(data []byte) (int, error) {
 	if len(buf) < parseQueryStrNumber {
 		return 0, fmt.Errorf("не удалось распарсить строку запроса: %w", ErrInvalidHTTPReq)
 	}
+	// отделяем параметры запроса от пути
+	rawPath, rawQuery, _ := strings.Cut(buf[1], "?")
+
 	// декодируем path на случай, если он не в латинице
-	convertPath, err := url.QueryUnescape(buf[1])
+	convertPath, err := url.QueryUnescape(rawPath)
 	if err != nil {
 		return 0, fmt.Errorf("не удалось распарсить строку запроса: %w", err)
 	}
 
 	q.method = buf[0]
-	q.path = convertPath
+	// нормализуем путь, чтобы он не мог выйти за пределы корневого каталога через ".."
+	q.path = path.Clean("/" + convertPath)
+	q.rawQuery = rawQuery
+	q.requestURI = buf[1]
 	q.protocol = buf[2]
 
 	return i, nil
@@ -131,7 +240,8 @@ func (r requestHeaders) parseRequestHeaders(data []byte, i int) error {
 			return fmt.Errorf("не удалось распарсить заголовок запроса %q: %w", buf[j], ErrInvalidHTTPHead)
 		}
 
-		r[buf[j][:sepIndex]] = strings.TrimSpace(buf[j][sepIndex+1:])
+		// имена заголовков не зависят от регистра: храним их в каноническом виде
+		r[textproto.CanonicalMIMEHeaderKey(buf[j][:sepIndex])] = strings.TrimSpace(buf[j][sepIndex+1:])
 	}
 
 	return nil
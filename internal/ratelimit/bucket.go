@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket - корзина токенов: пополняется со скоростью rate токенов в секунду, вмещает не более burst токенов
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket - создать заполненную корзину
+func NewBucket(rate, burst float64) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Allow - забрать один токен, если он есть; иначе вернуть время до появления токена
+func (b *Bucket) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return true, 0
+	}
+
+	return false, b.wait(1)
+}
+
+// Reserve - забрать n токенов, даже если их не хватает, и вернуть время,
+// которое нужно подождать, пока корзина не рассчитается по долгу
+func (b *Bucket) Reserve(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return b.wait(0)
+}
+
+// Full - корзина заполнена, то есть давно не использовалась
+func (b *Bucket) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+
+	return b.tokens >= b.burst
+}
+
+// Burst - возвращает емкость корзины
+func (b *Bucket) Burst() float64 {
+	return b.burst
+}
+
+// пополняем корзину за прошедшее время; вызывается под мьютексом
+func (b *Bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// время, за которое в корзине станет n токенов; вызывается под мьютексом
+func (b *Bucket) wait(n float64) time.Duration {
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,161 @@
+// Package ratelimit - пакет для ограничения частоты запросов и количества одновременных соединений клиентов
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrTooManyConns - превышено количество одновременных соединений с адреса или подсети клиента
+var ErrTooManyConns = errors.New("превышено количество одновременных соединений")
+
+const (
+	// как часто удалять неиспользуемые корзины
+	cleanupInterval = time.Minute
+	// через сколько неиспользуемая корзина удаляется
+	idleTimeout = 5 * time.Minute
+)
+
+// Config - параметры ограничений; нулевое значение параметра отключает соответствующее ограничение
+type Config struct {
+	// Rate - запросов в секунду с одного адреса
+	Rate float64
+	// Burst - сколько запросов подряд можно сделать сверх Rate
+	Burst int
+	// MaxConnsPerIP - одновременных соединений с одного адреса
+	MaxConnsPerIP int
+	// MaxConnsPerSubnet - одновременных соединений из одной подсети
+	MaxConnsPerSubnet int
+	// SubnetV4, SubnetV6 - длина префикса подсети для IPv4 и IPv6
+	SubnetV4 int
+	SubnetV6 int
+}
+
+// корзина запросов клиента
+type client struct {
+	bucket   *Bucket
+	lastSeen time.Time
+}
+
+// Limiter - ограничения частоты запросов и количества соединений по адресам клиентов
+type Limiter struct {
+	cfg Config
+
+	mu      sync.Mutex
+	clients map[string]*client
+	// количество открытых соединений по адресам и подсетям
+	ipConns     map[string]int
+	subnetConns map[string]int
+}
+
+// New - создать ограничитель и запустить удаление неиспользуемых корзин
+func New(cfg Config) *Limiter {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+
+	l := &Limiter{
+		cfg:         cfg,
+		clients:     make(map[string]*client),
+		ipConns:     make(map[string]int),
+		subnetConns: make(map[string]int),
+	}
+
+	go l.cleanup()
+
+	return l
+}
+
+// Allow - проверить ограничение частоты запросов для адреса;
+// если запрос не разрешен, возвращает время, через которое можно повторить запрос
+func (l *Limiter) Allow(ip net.IP) (bool, time.Duration) {
+	if l.cfg.Rate <= 0 || ip == nil {
+		return true, 0
+	}
+
+	key := ip.String()
+
+	l.mu.Lock()
+	c, ok := l.clients[key]
+
+	if !ok {
+		c = &client{bucket: NewBucket(l.cfg.Rate, float64(l.cfg.Burst))}
+		l.clients[key] = c
+	}
+
+	c.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	return c.bucket.Allow()
+}
+
+// Acquire - занять место под соединение с адреса; release нужно вызвать при закрытии соединения
+func (l *Limiter) Acquire(ip net.IP) (func(), error) {
+	if ip == nil || (l.cfg.MaxConnsPerIP <= 0 && l.cfg.MaxConnsPerSubnet <= 0) {
+		return func() {}, nil
+	}
+
+	ipKey, subnetKey := ip.String(), l.subnet(ip)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxConnsPerIP > 0 && l.ipConns[ipKey] >= l.cfg.MaxConnsPerIP {
+		return nil, ErrTooManyConns
+	}
+
+	if l.cfg.MaxConnsPerSubnet > 0 && l.subnetConns[subnetKey] >= l.cfg.MaxConnsPerSubnet {
+		return nil, ErrTooManyConns
+	}
+
+	l.ipConns[ipKey]++
+	l.subnetConns[subnetKey]++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			// удаляем нулевые счетчики, чтобы память не росла с количеством клиентов
+			if l.ipConns[ipKey]--; l.ipConns[ipKey] <= 0 {
+				delete(l.ipConns, ipKey)
+			}
+
+			if l.subnetConns[subnetKey]--; l.subnetConns[subnetKey] <= 0 {
+				delete(l.subnetConns, subnetKey)
+			}
+		})
+	}, nil
+}
+
+// подсеть адреса
+func (l *Limiter) subnet(ip net.IP) string {
+	bits, size := l.cfg.SubnetV6, net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits, size = ip4, l.cfg.SubnetV4, net.IPv4len
+	}
+
+	mask := net.CIDRMask(bits, 8*size)
+
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// периодически удаляем корзины клиентов, которые давно не делали запросов
+func (l *Limiter) cleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mu.Lock()
+		for key, c := range l.clients {
+			if time.Since(c.lastSeen) > idleTimeout && c.bucket.Full() {
+				delete(l.clients, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,215 @@
+// Package realip - пакет для определения адреса клиента за доверенными прокси
+// по заголовкам X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host и Forwarded (RFC 7239)
+package realip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Kostushka/tcp_server/internal/querydata"
+)
+
+// ErrInvalidNet - некорректный адрес или подсеть доверенного прокси
+var ErrInvalidNet = errors.New("некорректный адрес доверенного прокси")
+
+// ParseNets - парсим список адресов и подсетей через запятую: "10.0.0.0/8,127.0.0.1,::1"
+func ParseNets(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidNet, v)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidNet, v, err)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// Resolver - определяет адрес клиента, доверяя заголовкам только от прокси из списка
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// New - создать Resolver со списком подсетей доверенных прокси
+func New(trusted []*net.IPNet) *Resolver {
+	return &Resolver{trusted: trusted}
+}
+
+// Trusted - проверяет, является ли адрес доверенным прокси
+func (r *Resolver) Trusted(ip net.IP) bool {
+	if r == nil || ip == nil {
+		return false
+	}
+
+	for _, v := range r.trusted {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve - определяет клиента по адресу peer, с которого пришло соединение, и заголовкам запроса;
+// заголовкам верим, только если peer - доверенный прокси
+func (r *Resolver) Resolve(peer net.Addr, query *querydata.QueryData) querydata.Client {
+	client := querydata.Client{
+		Addr:   peer.String(),
+		Scheme: "http",
+		Host:   query.Header("Host"),
+	}
+
+	if host, _, err := net.SplitHostPort(client.Addr); err == nil {
+		client.IP = net.ParseIP(host)
+	}
+
+	if !r.Trusted(client.IP) {
+		return client
+	}
+
+	client.Proxied = true
+
+	// стандартный заголовок Forwarded имеет приоритет над X-Forwarded-*
+	if forwarded := query.Header("Forwarded"); forwarded != "" {
+		return r.resolveForwarded(client, forwarded)
+	}
+
+	// количество адресов в X-Forwarded-For и номер адреса клиента среди них
+	var count, index int
+
+	if xff := query.Header("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		count, index = len(hops), r.walk(hops)
+		client = setAddr(client, hops[index])
+	}
+
+	if proto := hopValue(query.Header("X-Forwarded-Proto"), count, index); proto != "" {
+		client.Scheme = strings.ToLower(proto)
+	}
+
+	if host := hopValue(query.Header("X-Forwarded-Host"), count, index); host != "" {
+		client.Host = host
+	}
+
+	return client
+}
+
+// определяем клиента по заголовку Forwarded: for=192.0.2.60;proto=https;host=example.com, for=...
+func (r *Resolver) resolveForwarded(client querydata.Client, forwarded string) querydata.Client {
+	elements := strings.Split(forwarded, ",")
+	params := make([]map[string]string, len(elements))
+	hops := make([]string, len(elements))
+
+	for i, v := range elements {
+		params[i] = parseElement(v)
+		hops[i] = params[i]["for"]
+	}
+
+	index := r.walk(hops)
+	client = setAddr(client, hops[index])
+
+	if proto := params[index]["proto"]; proto != "" {
+		client.Scheme = strings.ToLower(proto)
+	}
+
+	if host := params[index]["host"]; host != "" {
+		client.Host = host
+	}
+
+	return client
+}
+
+// идем по цепочке адресов справа налево, пропуская доверенные прокси;
+// возвращает индекс клиента: первого недоверенного адреса, если все доверенные - самого левого
+func (r *Resolver) walk(hops []string) int {
+	i := len(hops) - 1
+	for ; i > 0; i-- {
+		if !r.Trusted(parseNode(strings.TrimSpace(hops[i]))) {
+			break
+		}
+	}
+
+	return max(i, 0)
+}
+
+// сохраняем адрес клиента из заголовка; пустой адрес не заменяет адрес соединения
+func setAddr(client querydata.Client, addr string) querydata.Client {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return client
+	}
+
+	client.Addr = strings.Trim(addr, `"`)
+	client.IP = parseNode(addr)
+
+	return client
+}
+
+// парсим адрес узла: 192.0.2.43, 192.0.2.43:47011, [2001:db8::1]:4711, 2001:db8::1
+func parseNode(addr string) net.IP {
+	addr = strings.Trim(addr, `"`)
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// парсим элемент заголовка Forwarded: пары key=value через точку с запятой
+func parseElement(s string) map[string]string {
+	params := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+
+		params[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+
+	return params
+}
+
+// значение X-Forwarded-Proto или X-Forwarded-Host для клиента: элемент с тем же номером, что и адрес клиента
+// среди count адресов X-Forwarded-For, если списки одной длины, иначе самый правый - его добавил
+// ближайший доверенный прокси; левые элементы мог подставить сам клиент
+func hopValue(s string, count, index int) string {
+	if s == "" {
+		return ""
+	}
+
+	values := strings.Split(s, ",")
+	if len(values) != count {
+		index = len(values) - 1
+	}
+
+	return strings.TrimSpace(values[index])
+}
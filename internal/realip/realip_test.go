@@ -0,0 +1,58 @@
+package realip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Kostushka/tcp_server/internal/querydata"
+)
+
+func resolve(t *testing.T, headers string) querydata.Client {
+	t.Helper()
+
+	nets, err := ParseNets("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := querydata.NewParseQueryData([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n" + headers + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(nets).Resolve(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, query)
+}
+
+func TestResolveCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		name, headers, ip, scheme, host string
+	}{
+		{
+			name:    "X-Forwarded-*",
+			headers: "x-forwarded-for: 192.0.2.1\r\nx-forwarded-proto: HTTPS\r\nx-forwarded-host: a.example\r\n",
+			ip:      "192.0.2.1", scheme: "https", host: "a.example",
+		},
+		{
+			name:    "Forwarded",
+			headers: "forwarded: for=192.0.2.2;proto=https;host=b.example\r\n",
+			ip:      "192.0.2.2", scheme: "https", host: "b.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := resolve(t, tt.headers)
+			if c.IP.String() != tt.ip || c.Scheme != tt.scheme || c.Host != tt.host {
+				t.Errorf("клиент %v %s %s, ожидался %s %s %s", c.IP, c.Scheme, c.Host, tt.ip, tt.scheme, tt.host)
+			}
+		})
+	}
+}
+
+func TestResolveForwardedHop(t *testing.T) {
+	// значения, подставленные клиентом слева, не учитываются
+	c := resolve(t, "X-Forwarded-For: 6.6.6.6, 192.0.2.3\r\nX-Forwarded-Host: evil.example, c.example\r\n")
+	if c.IP.String() != "192.0.2.3" || c.Host != "c.example" {
+		t.Errorf("клиент %v %s, ожидался 192.0.2.3 c.example", c.IP, c.Host)
+	}
+}
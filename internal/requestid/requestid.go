@@ -0,0 +1,47 @@
+// Package requestid - пакет для получения идентификатора запроса, по которому связываются строки лога
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Header - заголовок, в котором идентификатор запроса принимается от прокси и возвращается клиенту
+const Header = "X-Request-ID"
+
+// максимальная длина идентификатора, принимаемого от прокси
+const maxLen = 128
+
+// запасной счетчик на случай, если системный генератор случайных чисел недоступен
+var counter atomic.Uint64
+
+// New - сгенерировать уникальный идентификатор запроса
+func New() string {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		// идентификатор остается уникальным в пределах процесса
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + "-" + strconv.FormatUint(counter.Add(1), 16)
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
+// Valid - проверяет идентификатор, полученный от прокси: непустой, не длиннее 128 символов,
+// только видимые ASCII-символы, чтобы его нельзя было использовать для подделки строк лога и заголовков
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,253 @@
+// Package rewrite - пакет с правилами перезаписи пути запроса и перенаправлений
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidRule - некорректное правило перезаписи
+var ErrInvalidRule = errors.New("некорректное правило перезаписи")
+
+// Config - правило перезаписи из файла конфигурации сайта
+type Config struct {
+	// Pattern - регулярное выражение для пути запроса
+	Pattern string `json:"pattern"`
+	// Replacement - новый путь или адрес перенаправления; $1..$9 и ${name} - группы из Pattern.
+	// Если в нем есть '?', параметры исходного запроса добавляются после новых
+	Replacement string `json:"replacement"`
+	// Code - код перенаправления 301, 302, 307 или 308; 0 - внутренняя перезапись пути
+	Code int `json:"code"`
+	// Last - после внутренней перезаписи следующие правила не проверяются
+	Last bool `json:"last"`
+	// If - условия применения правила, все должны выполняться
+	If *Condition `json:"if"`
+}
+
+// Condition - условия применения правила
+type Condition struct {
+	// Host - регулярное выражение для имени хоста
+	Host string `json:"host"`
+	// Methods - методы запроса
+	Methods []string `json:"methods"`
+	// File - проверка файла, соответствующего пути запроса: -f (файл есть), -d (каталог есть),
+	// -e (файл или каталог есть); с '!' в начале - проверка отсутствия
+	File string `json:"file"`
+}
+
+// Result - результат применения правил
+type Result struct {
+	// Path, RawQuery - путь и параметры запроса после внутренней перезаписи
+	Path     string
+	RawQuery string
+	// Redirect - адрес перенаправления, пустая строка - перенаправления нет
+	Redirect string
+	// Code - код перенаправления
+	Code int
+}
+
+// правило, готовое к применению
+type rule struct {
+	cfg     Config
+	re      *regexp.Regexp
+	host    *regexp.Regexp
+	methods []string
+	// проверка файла: тип и ожидаемое наличие
+	fileTest byte
+	fileWant bool
+}
+
+// Rules - список правил, применяемых по порядку
+type Rules struct {
+	rules []*rule
+}
+
+// New - создать список правил
+func New(cfgs []Config) (*Rules, error) {
+	r := &Rules{}
+
+	for i, cfg := range cfgs {
+		rl, err := newRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("правило %d (%q): %w", i+1, cfg.Pattern, err)
+		}
+
+		r.rules = append(r.rules, rl)
+	}
+
+	return r, nil
+}
+
+func newRule(cfg Config) (*rule, error) {
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+	}
+
+	rl := &rule{cfg: cfg, re: re}
+
+	switch cfg.Code {
+	case 0, 301, 302, 307, 308:
+	default:
+		return nil, fmt.Errorf("%w: код перенаправления %d", ErrInvalidRule, cfg.Code)
+	}
+
+	if cfg.Code == 0 && !strings.HasPrefix(cfg.Replacement, "/") {
+		return nil, fmt.Errorf("%w: внутренняя перезапись должна давать путь, начинающийся с /", ErrInvalidRule)
+	}
+
+	if cfg.If == nil {
+		return rl, nil
+	}
+
+	if cfg.If.Host != "" {
+		if rl.host, err = regexp.Compile("(?i)" + cfg.If.Host); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+		}
+	}
+
+	for _, m := range cfg.If.Methods {
+		rl.methods = append(rl.methods, strings.ToUpper(m))
+	}
+
+	if test := cfg.If.File; test != "" {
+		rl.fileWant = !strings.HasPrefix(test, "!")
+		test = strings.TrimPrefix(test, "!")
+
+		if test != "-f" && test != "-d" && test != "-e" {
+			return nil, fmt.Errorf("%w: неизвестная проверка файла %q", ErrInvalidRule, cfg.If.File)
+		}
+
+		rl.fileTest = test[1]
+	}
+
+	return rl, nil
+}
+
+// Apply - применить правила к запросу; root - каталог, в котором проверяется наличие файлов.
+// Возвращает false, если ни одно правило не подошло
+func (r *Rules) Apply(method, host, urlPath, rawQuery, root string) (Result, bool) {
+	res := Result{Path: urlPath, RawQuery: rawQuery}
+
+	if r == nil {
+		return res, false
+	}
+
+	applied := false
+
+	for _, rl := range r.rules {
+		m := rl.re.FindStringSubmatchIndex(res.Path)
+		if m == nil || !rl.matches(method, host, res.Path, root) {
+			continue
+		}
+
+		var target string
+
+		if rl.cfg.Code != 0 {
+			// путь запроса уже декодирован: в адрес перенаправления захваченные части
+			// подставляются экранированными, иначе %0D%0A превратится в перевод строки в заголовке Location
+			src, idx := escapeGroups(res.Path, m)
+			target = string(rl.re.ExpandString(nil, rl.cfg.Replacement, src, idx))
+		} else {
+			target = string(rl.re.ExpandString(nil, rl.cfg.Replacement, res.Path, m))
+		}
+
+		target, query, hasQuery := strings.Cut(target, "?")
+
+		// параметры исходного запроса сохраняются, как в nginx
+		switch {
+		case !hasQuery:
+			query = res.RawQuery
+		case res.RawQuery != "" && query != "":
+			query += "&" + res.RawQuery
+		case res.RawQuery != "":
+			query = res.RawQuery
+		}
+
+		applied = true
+
+		if rl.cfg.Code != 0 {
+			res.Redirect = target
+			if query != "" {
+				res.Redirect += "?" + query
+			}
+
+			res.Code = rl.cfg.Code
+
+			return res, true
+		}
+
+		// новый путь не может выйти за пределы корневого каталога
+		res.Path = path.Clean("/" + target)
+		res.RawQuery = query
+
+		if rl.cfg.Last {
+			break
+		}
+	}
+
+	return res, applied
+}
+
+// строка из экранированных групп совпадения и индексы групп в ней, для подстановки в ExpandString;
+// каждый сегмент пути экранируется url.PathEscape, '/' сохраняется
+func escapeGroups(s string, m []int) (string, []int) {
+	var b strings.Builder
+
+	idx := make([]int, len(m))
+
+	for i := 0; i < len(m); i += 2 {
+		if m[i] < 0 {
+			idx[i], idx[i+1] = -1, -1
+
+			continue
+		}
+
+		segments := strings.Split(s[m[i]:m[i+1]], "/")
+		for j, seg := range segments {
+			segments[j] = url.PathEscape(seg)
+		}
+
+		idx[i] = b.Len()
+		b.WriteString(strings.Join(segments, "/"))
+		idx[i+1] = b.Len()
+	}
+
+	return b.String(), idx
+}
+
+// выполняются ли условия правила
+func (rl *rule) matches(method, host, urlPath, root string) bool {
+	if rl.host != nil && !rl.host.MatchString(host) {
+		return false
+	}
+
+	if len(rl.methods) > 0 && !slices.Contains(rl.methods, method) {
+		return false
+	}
+
+	if rl.fileTest == 0 {
+		return true
+	}
+
+	fi, err := os.Stat(path.Join(root, urlPath))
+
+	var ok bool
+
+	switch rl.fileTest {
+	case 'f':
+		ok = err == nil && fi.Mode().IsRegular()
+	case 'd':
+		ok = err == nil && fi.IsDir()
+	default:
+		ok = err == nil
+	}
+
+	return ok == rl.fileWant
+}
@@ -0,0 +1,294 @@
+// Package rotate - пакет с файлом лога, который ротируется по размеру и по времени
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	permissions = 0644
+	// суффикс ротированного файла: время ротации
+	timeLayout = "20060102-150405"
+	gzipExt    = ".gz"
+	// через сколько повторить неудавшуюся ротацию: до этого запись идет в текущий файл
+	rotateRetry = time.Minute
+)
+
+// Config - параметры ротации; нулевое значение параметра отключает соответствующее условие
+type Config struct {
+	// MaxSize - ротировать, когда размер файла превысит MaxSize байт
+	MaxSize int64
+	// Interval - ротировать, когда с момента открытия файла прошло Interval
+	Interval time.Duration
+	// MaxBackups - сколько ротированных файлов хранить, 0 - хранить все
+	MaxBackups int
+	// Compress - сжимать ротированные файлы gzip
+	Compress bool
+}
+
+// File - файл лога с ротацией; безопасен для записи из нескольких горутин
+type File struct {
+	path string
+	cfg  Config
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	// до этого времени ротация не повторяется после ошибки
+	retryAt time.Time
+	// ожидание фоновых сжатия и удаления старых файлов
+	wg sync.WaitGroup
+}
+
+// Open - открыть файл лога для дозаписи
+func Open(path string, cfg Config) (*File, error) {
+	f := &File{path: path, cfg: cfg}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write - записать данные, при необходимости предварительно ротировав файл
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// если ротировать не удалось, продолжаем писать в текущий файл, чтобы не терять лог
+	if f.needRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			f.retryAt = time.Now().Add(rotateRetry)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Rotate - ротировать файл немедленно
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rotate()
+}
+
+// Close - закрыть файл и дождаться завершения фоновых операций
+func (f *File) Close() error {
+	f.mu.Lock()
+	err := f.f.Close()
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	return err
+}
+
+// нужна ли ротация перед записью n байт; вызывается под мьютексом
+func (f *File) needRotate(n int64) bool {
+	if time.Now().Before(f.retryAt) {
+		return false
+	}
+
+	if f.cfg.MaxSize > 0 && f.size > 0 && f.size+n > f.cfg.MaxSize {
+		return true
+	}
+
+	return f.cfg.Interval > 0 && time.Since(f.openedAt) >= f.cfg.Interval
+}
+
+// открываем файл; вызывается под мьютексом или до начала использования
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, permissions) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return err
+	}
+
+	f.f = file
+	f.size = fi.Size()
+	f.openedAt = time.Now()
+
+	return nil
+}
+
+// переименовываем текущий файл, открываем новый и только потом закрываем старый;
+// при ошибке остается открытым старый файл, и запись продолжается в него; вызывается под мьютексом
+func (f *File) rotate() error {
+	backup := f.backupName(time.Now())
+
+	// открытый дескриптор продолжает указывать на переименованный файл
+	renamed := true
+
+	if err := os.Rename(f.path, backup); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("не удалось ротировать файл лога %q: %w", f.path, err)
+		}
+
+		renamed = false
+	}
+
+	old := f.f
+
+	if err := f.open(); err != nil {
+		return fmt.Errorf("не удалось открыть файл лога %q после ротации: %w", f.path, err)
+	}
+
+	if err := old.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "не удалось закрыть файл лога %q: %v\n", backup, err)
+	}
+
+	f.retryAt = time.Time{}
+
+	// сжатие и удаление старых файлов не задерживают запись в лог
+	f.wg.Add(1)
+
+	go func() {
+		defer f.wg.Done()
+
+		if f.cfg.Compress && renamed {
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "не удалось сжать файл лога %q: %v\n", backup, err)
+			}
+		}
+
+		if err := f.removeOld(); err != nil {
+			fmt.Fprintf(os.Stderr, "не удалось удалить старые файлы лога %q: %v\n", f.path, err)
+		}
+	}()
+
+	return nil
+}
+
+// имя ротированного файла: path.20240102-150405, при совпадении добавляется номер
+func (f *File) backupName(t time.Time) string {
+	name := f.path + "." + t.Format(timeLayout)
+
+	for i := 1; ; i++ {
+		if !exists(name) && !exists(name+gzipExt) {
+			return name
+		}
+
+		name = f.path + "." + t.Format(timeLayout) + "." + strconv.Itoa(i)
+	}
+}
+
+// удаляем ротированные файлы сверх MaxBackups, начиная с самых старых
+func (f *File) removeOld() error {
+	if f.cfg.MaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	// учитываем только ротированные файлы этого лога: path.20240102-150405[.N][.gz],
+	// а не другие файлы с тем же началом имени
+	backupRe := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(f.path)) + `\.\d{8}-\d{6}(\.\d+)?(\.gz)?$`)
+
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+
+	var backups []backup
+
+	for _, m := range matches {
+		// временный файл, который сейчас сжимается, тоже не подходит
+		if !backupRe.MatchString(filepath.Base(m)) {
+			continue
+		}
+
+		fi, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{path: m, modTime: fi.ModTime()})
+	}
+
+	if len(backups) <= f.cfg.MaxBackups {
+		return nil
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	for _, b := range backups[f.cfg.MaxBackups:] {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// сжимаем файл в path.gz и удаляем исходный
+func compress(path string) error {
+	src, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// пишем во временный файл, чтобы не оставить недописанный архив
+	tmp := path + gzipExt + ".tmp"
+
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, permissions) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(dst)
+
+	_, err = io.Copy(gw, src)
+	if err == nil {
+		err = gw.Close()
+	}
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+
+	if err = os.Rename(tmp, path+gzipExt); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
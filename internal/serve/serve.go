@@ -0,0 +1,213 @@
+// Package serve - пакет, принимающий соединения и обрабатывающий их с общими настройками сервера;
+// на нем построены исполняемый файл сервера и встраиваемый пакет server
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/connection"
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/connection/types"
+	"github.com/Kostushka/tcp_server/internal/log"
+)
+
+// ErrServerClosed - сервер остановлен вызовом Shutdown
+var ErrServerClosed = errors.New("сервер остановлен")
+
+// как часто Shutdown проверяет, завершились ли открытые соединения
+const shutdownPollInterval = 100 * time.Millisecond
+
+// Server - принимает соединения и отслеживает открытые до остановки
+type Server struct {
+	settings *connection.Settings
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// New - создать сервер с полным набором настроек соединений (кеши, аутентификация,
+// ограничения, журналы); settings.Handler == nil - отдаются файлы из settings.RootPath
+func New(settings *connection.Settings) *Server {
+	return &Server{
+		settings:  settings,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve - принимать соединения из l, каждое обрабатывается в отдельной горутине;
+// после Shutdown возвращает ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
+	log.Infof("Запуск сервера с адресом %v", l.Addr())
+
+	for {
+		log.Infof("tcp сокет слушает соединения")
+		// слушаем сокетные соединения (запросы)
+		conn, err := l.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+
+			log.Errorf(err)
+
+			if s.settings.Metrics != nil {
+				s.settings.Metrics.AcceptError()
+			}
+
+			continue
+		}
+
+		log.Infof("запрос на соединение от клиента принят")
+
+		// обрабатываем каждое клиентское соединение в отдельной горутине
+		go s.serve(conn)
+	}
+}
+
+// Shutdown - перестать принимать соединения и дождаться завершения открытых;
+// если ctx завершится раньше, оставшиеся соединения закрываются принудительно
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+
+	var err error
+
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.activeConns() == 0 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// проверяем ограничение количества соединений клиента и обрабатываем соединение
+func (s *Server) serve(conn net.Conn) {
+	if !s.trackConn(conn, true) {
+		connection.Close(conn, "")
+
+		return
+	}
+	defer s.trackConn(conn, false)
+
+	settings := s.settings
+
+	if settings.Metrics != nil {
+		settings.Metrics.ConnOpened()
+		defer settings.Metrics.ConnClosed()
+	}
+
+	if settings.Limiter != nil {
+		var ip net.IP
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			ip = addr.IP
+		}
+
+		release, err := settings.Limiter.Acquire(ip)
+		if err != nil {
+			connection.Reject(conn, &types.StatusData{
+				Code:    consts.StatusTooManyRequests,
+				Headers: []types.Header{connection.RetryAfter(time.Second)},
+			}, fmt.Errorf("соединение с %v отклонено: %w", conn.RemoteAddr(), err))
+
+			return
+		}
+		defer release()
+	}
+
+	// создаем структуру с данными клиентского соединения и обрабатываем его
+	connection.New(conn, settings).ProcessingConn()
+}
+
+// добавить или удалить слушающий сокет; false - сервер уже остановлен
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, l)
+
+		return true
+	}
+
+	if s.closed {
+		return false
+	}
+
+	s.listeners[l] = struct{}{}
+
+	return true
+}
+
+// добавить или удалить открытое соединение; false - сервер уже остановлен
+func (s *Server) trackConn(conn net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, conn)
+
+		return true
+	}
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+
+	return true
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *Server) activeConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// принудительно закрыть открытые соединения: их обработка прервется на ближайшем чтении или записи
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		connection.Close(conn, "")
+	}
+}
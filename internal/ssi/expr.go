@@ -0,0 +1,248 @@
+package ssi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// виды лексем выражения директивы if
+const (
+	tokString = iota
+	tokRegex
+	tokOp
+)
+
+// token - лексема выражения: строка, регулярное выражение или оператор
+type token struct {
+	kind  int
+	value string
+}
+
+// вычислить выражение директивы if в синтаксисе Apache:
+// "строка", $var, строка = /regexp/, строка != строка, < <= > >=, !, &&, || и скобки
+func (s *state) eval(expr string) (bool, error) {
+	tokens, err := s.tokenize(expr)
+	if err != nil {
+		return false, err
+	}
+
+	if len(tokens) == 0 {
+		return false, fmt.Errorf("%w: пустое выражение", ErrDirective)
+	}
+
+	p := &exprParser{tokens: tokens}
+
+	result, err := p.or()
+	if err != nil {
+		return false, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("%w: лишняя лексема %q в выражении", ErrDirective, p.tokens[p.pos].value)
+	}
+
+	return result, nil
+}
+
+// разбить выражение на лексемы; в строках подставляются переменные,
+// идущие подряд строки объединяются через пробел
+func (s *state) tokenize(expr string) ([]token, error) {
+	var tokens []token
+
+	add := func(t token) {
+		if n := len(tokens); t.kind == tokString && n > 0 && tokens[n-1].kind == tokString {
+			tokens[n-1].value += " " + t.value
+
+			return
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") ||
+			strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+			strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">="):
+			add(token{kind: tokOp, value: expr[i : i+2]})
+			i += 2
+		case strings.IndexByte("()!=<>", c) != -1:
+			add(token{kind: tokOp, value: expr[i : i+1]})
+			i++
+		case c == '/':
+			end := closingQuote(expr[i:])
+			if end == -1 {
+				return nil, fmt.Errorf("%w: незакрытое регулярное выражение в %q", ErrDirective, expr)
+			}
+
+			add(token{kind: tokRegex, value: expr[i+1 : i+end]})
+			i += end + 1
+		case c == '"' || c == '\'':
+			end := closingQuote(expr[i:])
+			if end == -1 {
+				return nil, fmt.Errorf("%w: незакрытая кавычка в %q", ErrDirective, expr)
+			}
+
+			add(token{kind: tokString, value: s.expand(unescapeQuote(expr[i+1:i+end], c))})
+			i += end + 1
+		default:
+			j := i
+			for j < len(expr) && strings.IndexByte(" \t\r\n()!=<>&|\"'", expr[j]) == -1 {
+				j++
+			}
+
+			if j == i {
+				return nil, fmt.Errorf("%w: неожиданный символ %q в выражении", ErrDirective, c)
+			}
+
+			add(token{kind: tokString, value: s.expand(expr[i:j])})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+// exprParser - разбор выражения рекурсивным спуском; || связывает слабее, чем &&
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+// следующая лексема-оператор, если она совпадает с одним из ops
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokOp {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if p.tokens[p.pos].value == op {
+			p.pos++
+
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+// выражение1 || выражение2
+func (p *exprParser) or() (bool, error) {
+	result, err := p.and()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return result, nil
+		}
+
+		right, err := p.and()
+		if err != nil {
+			return false, err
+		}
+
+		result = result || right
+	}
+}
+
+// выражение1 && выражение2
+func (p *exprParser) and() (bool, error) {
+	result, err := p.unary()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return result, nil
+		}
+
+		right, err := p.unary()
+		if err != nil {
+			return false, err
+		}
+
+		result = result && right
+	}
+}
+
+// !выражение, (выражение), сравнение или строка, истинная, если она не пустая
+func (p *exprParser) unary() (bool, error) {
+	if _, ok := p.accept("!"); ok {
+		result, err := p.unary()
+
+		return !result, err
+	}
+
+	if _, ok := p.accept("("); ok {
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok = p.accept(")"); !ok {
+			return false, fmt.Errorf("%w: не закрыта скобка в выражении", ErrDirective)
+		}
+
+		return result, nil
+	}
+
+	left, err := p.str()
+	if err != nil {
+		return false, err
+	}
+
+	op, ok := p.accept("=", "==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left != "", nil
+	}
+
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokRegex && (op == "=" || op == "==" || op == "!=") {
+		re, err := regexp.Compile(p.tokens[p.pos].value)
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrDirective, err)
+		}
+
+		p.pos++
+
+		return re.MatchString(left) == (op != "!="), nil
+	}
+
+	right, err := p.str()
+	if err != nil {
+		return false, err
+	}
+
+	switch op {
+	case "=", "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	default:
+		return left >= right, nil
+	}
+}
+
+// следующая лексема-строка
+func (p *exprParser) str() (string, error) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokString {
+		return "", fmt.Errorf("%w: ожидалась строка в выражении", ErrDirective)
+	}
+
+	p.pos++
+
+	return p.tokens[p.pos-1].value, nil
+}
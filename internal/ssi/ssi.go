@@ -0,0 +1,628 @@
+// Package ssi - пакет, выполняющий безопасное подмножество директив Server-Side Includes:
+// include, echo, set, if/elif/else/endif, fsize и flastmod
+package ssi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+)
+
+const (
+	// DefaultMaxDepth - глубина вложенности include по умолчанию
+	DefaultMaxDepth = 8
+	// DefaultMaxIncludes - сколько include выполняется на одной странице по умолчанию
+	DefaultMaxIncludes = 128
+
+	// вместо директивы, которая не выполнена, в страницу выводится сообщение, как в Apache
+	errMsg = "[an error occurred while processing this directive]"
+	// формат времени по умолчанию в Apache: %A, %d-%b-%Y %H:%M:%S %Z
+	timeFormat = "Monday, 02-Jan-2006 15:04:05 MST"
+
+	directiveStart = "<!--#"
+	directiveEnd   = "-->"
+)
+
+var (
+	// ErrDirective - некорректная или неизвестная директива
+	ErrDirective = errors.New("некорректная директива SSI")
+	// ErrInclude - файл не может быть включен в страницу
+	ErrInclude = errors.New("файл не может быть включен")
+	// ErrLimit - превышена глубина вложенности или количество include
+	ErrLimit = errors.New("превышено ограничение SSI")
+)
+
+// Config - параметры обработки SSI
+type Config struct {
+	// Extensions - расширения файлов с директивами SSI, например ".shtml"; пусто - SSI отключено
+	Extensions []string
+	// MaxDepth - максимальная глубина вложенности include, по умолчанию DefaultMaxDepth
+	MaxDepth int
+	// MaxIncludes - максимальное количество include на одной странице, по умолчанию DefaultMaxIncludes
+	MaxIncludes int
+}
+
+// Processor - выполняет директивы SSI в файлах с заданными расширениями
+type Processor struct {
+	cfg Config
+}
+
+// New - создать обработчик директив SSI
+func New(cfg Config) *Processor {
+	exts := make([]string, 0, len(cfg.Extensions))
+
+	for _, ext := range cfg.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		exts = append(exts, ext)
+	}
+
+	cfg.Extensions = exts
+
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = DefaultMaxDepth
+	}
+
+	if cfg.MaxIncludes <= 0 {
+		cfg.MaxIncludes = DefaultMaxIncludes
+	}
+
+	return &Processor{cfg: cfg}
+}
+
+// Match - возвращает true, если в файле name нужно выполнять директивы SSI
+func (p *Processor) Match(name string) bool {
+	if p == nil {
+		return false
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+
+	for _, v := range p.cfg.Extensions {
+		if v == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Document - страница, в которой выполняются директивы
+type Document struct {
+	// File - путь до файла страницы
+	File string
+	// URLPath - путь запроса страницы
+	URLPath string
+	// ModTime - время изменения файла страницы
+	ModTime time.Time
+	// Vars - переменные запроса, доступные директивам echo и if
+	Vars map[string]string
+	// Resolve - возвращает путь до файла по пути запроса include virtual или include file
+	// или ошибку, если путь не может быть включен в страницу
+	Resolve func(urlPath string) (string, error)
+	// Log - логер запроса
+	Log *log.Logger
+}
+
+// Process - выполнить директивы в содержимом страницы src; директивы с ошибкой
+// заменяются сообщением об ошибке, а сама ошибка записывается в лог запроса
+func (p *Processor) Process(doc Document, src []byte) []byte {
+	now := time.Now()
+
+	vars := map[string]string{
+		"DOCUMENT_NAME": filepath.Base(doc.File),
+		"DOCUMENT_URI":  doc.URLPath,
+		"DATE_LOCAL":    now.Format(timeFormat),
+		"DATE_GMT":      now.UTC().Format(timeFormat),
+		"LAST_MODIFIED": doc.ModTime.Format(timeFormat),
+	}
+
+	for k, v := range doc.Vars {
+		vars[k] = v
+	}
+
+	s := &state{p: p, doc: doc, vars: vars}
+	s.run(src, frame{file: doc.File, urlPath: doc.URLPath})
+
+	return s.out.Bytes()
+}
+
+// state - состояние обработки одной страницы
+type state struct {
+	p        *Processor
+	doc      Document
+	vars     map[string]string
+	out      bytes.Buffer
+	includes int
+}
+
+// frame - обрабатываемый файл: сама страница или включенный в нее файл
+type frame struct {
+	file    string
+	urlPath string
+	depth   int
+}
+
+// cond - блок if; active - выводится текущая ветка, taken - одна из веток уже выбрана
+type cond struct {
+	active bool
+	taken  bool
+}
+
+// attr - параметр директивы; параметры могут повторяться, поэтому важен их порядок
+type attr struct {
+	name  string
+	value string
+}
+
+// выполнить директивы в содержимом файла f; блоки if не выходят за пределы файла
+func (s *state) run(src []byte, f frame) {
+	var conds []cond
+
+	// выводится ли текущая ветка: каждая вложенная ветка активна, только если активна внешняя
+	active := func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active
+	}
+
+	for len(src) > 0 {
+		i := bytes.Index(src, []byte(directiveStart))
+		if i == -1 {
+			break
+		}
+
+		end := bytes.Index(src[i:], []byte(directiveEnd))
+		if end == -1 {
+			break
+		}
+
+		if active() {
+			s.out.Write(src[:i])
+		}
+
+		name, attrs, err := parseDirective(string(src[i+len(directiveStart) : i+end]))
+		src = src[i+end+len(directiveEnd):]
+
+		switch {
+		case err != nil:
+			if active() {
+				s.fail(f, err)
+			}
+		case name == "if":
+			c := cond{}
+
+			if active() {
+				c.taken, err = s.condition(attrs)
+				if err != nil {
+					s.fail(f, err)
+				}
+
+				c.active = c.taken
+			}
+
+			conds = append(conds, c)
+		case name == "elif" || name == "else" || name == "endif":
+			if len(conds) == 0 {
+				s.fail(f, fmt.Errorf("%w: %s без if", ErrDirective, name))
+
+				continue
+			}
+
+			c := &conds[len(conds)-1]
+			// внешняя ветка активна, если активен блок, в который вложен текущий if
+			outer := len(conds) == 1 || conds[len(conds)-2].active
+
+			switch name {
+			case "elif":
+				c.active = false
+
+				if outer && !c.taken {
+					c.active, err = s.condition(attrs)
+					if err != nil {
+						s.fail(f, err)
+					}
+
+					c.taken = c.active
+				}
+			case "else":
+				c.active = outer && !c.taken
+				c.taken = true
+			default:
+				conds = conds[:len(conds)-1]
+			}
+		case active():
+			if err = s.directive(f, name, attrs); err != nil {
+				s.fail(f, err)
+			}
+		}
+	}
+
+	if active() {
+		s.out.Write(src)
+	}
+
+	if len(conds) > 0 {
+		s.doc.Log.Errorf("SSI %q: %v", f.file, fmt.Errorf("%w: if без endif", ErrDirective))
+	}
+}
+
+// выполнить директиву, которая выводит данные или задает переменные
+func (s *state) directive(f frame, name string, attrs []attr) error {
+	switch name {
+	case "include":
+		return s.include(f, attrs)
+	case "echo":
+		return s.echo(attrs)
+	case "set":
+		return s.set(attrs)
+	case "fsize", "flastmod":
+		file, _, err := s.target(f, attrs)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInclude, err)
+		}
+
+		if name == "fsize" {
+			s.out.WriteString(formatSize(fi.Size()))
+		} else {
+			s.out.WriteString(html.EscapeString(fi.ModTime().Format(timeFormat)))
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: неизвестная директива %q", ErrDirective, name)
+	}
+}
+
+// include virtual="путь запроса" или include file="путь относительно текущего файла"
+func (s *state) include(f frame, attrs []attr) error {
+	file, urlPath, err := s.target(f, attrs)
+	if err != nil {
+		return err
+	}
+
+	if f.depth >= s.p.cfg.MaxDepth {
+		return fmt.Errorf("%w: глубина вложенности больше %d", ErrLimit, s.p.cfg.MaxDepth)
+	}
+
+	if s.includes >= s.p.cfg.MaxIncludes {
+		return fmt.Errorf("%w: на странице больше %d include", ErrLimit, s.p.cfg.MaxIncludes)
+	}
+
+	s.includes++
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInclude, err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %q не является файлом", ErrInclude, file)
+	}
+
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInclude, err)
+	}
+
+	// директивы выполняются только в файлах с расширениями SSI, остальные включаются как есть
+	if !s.p.Match(file) {
+		s.out.Write(data)
+
+		return nil
+	}
+
+	s.run(data, frame{file: file, urlPath: urlPath, depth: f.depth + 1})
+
+	return nil
+}
+
+// путь до файла и путь запроса из параметра virtual или file директив include, fsize и flastmod
+func (s *state) target(f frame, attrs []attr) (string, string, error) {
+	for _, a := range attrs {
+		value := s.expand(a.value)
+
+		switch a.name {
+		case "virtual":
+			value, _, _ = strings.Cut(value, "?")
+			if !strings.HasPrefix(value, "/") {
+				value = path.Join(path.Dir(f.urlPath), value)
+			}
+			// путь нормализуется так же, как путь запроса, и не выходит за пределы корневого каталога
+			urlPath := path.Clean("/" + value)
+
+			return s.resolve(urlPath)
+		case "file":
+			// file указывает только на файлы в каталоге текущего файла и его подкаталогах
+			rel := path.Clean(filepath.ToSlash(value))
+			if value == "" || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+				return "", "", fmt.Errorf("%w: недопустимый путь %q", ErrInclude, value)
+			}
+
+			// файл проверяется по тем же правилам, что и путь запроса include virtual
+			return s.resolve(path.Join(path.Dir(f.urlPath), rel))
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: не указан параметр virtual или file", ErrDirective)
+}
+
+// путь до файла по пути запроса: скрытые файлы и каталоги (.htpasswd, .git) не включаются,
+// остальные пути проверяет Document.Resolve
+func (s *state) resolve(urlPath string) (string, string, error) {
+	for _, segment := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", "", fmt.Errorf("%w: скрытый файл %q", ErrInclude, urlPath)
+		}
+	}
+
+	file, err := s.doc.Resolve(urlPath)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInclude, err)
+	}
+
+	return file, urlPath, nil
+}
+
+// echo var="имя" [encoding="entity|url|none"]; encoding действует на следующие за ним var
+func (s *state) echo(attrs []attr) error {
+	encoding := "entity"
+	printed := false
+
+	for _, a := range attrs {
+		switch a.name {
+		case "encoding":
+			encoding = strings.ToLower(a.value)
+			if encoding != "entity" && encoding != "url" && encoding != "none" {
+				return fmt.Errorf("%w: неизвестная кодировка %q", ErrDirective, a.value)
+			}
+		case "var":
+			value, ok := s.vars[s.expand(a.value)]
+			if !ok {
+				value = "(none)"
+			}
+
+			switch encoding {
+			case "url":
+				value = url.QueryEscape(value)
+			case "entity":
+				value = html.EscapeString(value)
+			}
+
+			s.out.WriteString(value)
+
+			printed = true
+		default:
+			return fmt.Errorf("%w: неизвестный параметр echo %q", ErrDirective, a.name)
+		}
+	}
+
+	if !printed {
+		return fmt.Errorf("%w: не указан параметр var", ErrDirective)
+	}
+
+	return nil
+}
+
+// set var="имя" value="значение"; в значении подставляются переменные
+func (s *state) set(attrs []attr) error {
+	var name string
+
+	for _, a := range attrs {
+		switch a.name {
+		case "var":
+			name = s.expand(a.value)
+		case "value":
+			if name == "" {
+				return fmt.Errorf("%w: value указан раньше var", ErrDirective)
+			}
+
+			s.vars[name] = s.expand(a.value)
+			name = ""
+		default:
+			return fmt.Errorf("%w: неизвестный параметр set %q", ErrDirective, a.name)
+		}
+	}
+
+	if name != "" {
+		return fmt.Errorf("%w: для переменной %q не указан value", ErrDirective, name)
+	}
+
+	return nil
+}
+
+// условие директивы if или elif из параметра expr
+func (s *state) condition(attrs []attr) (bool, error) {
+	for _, a := range attrs {
+		if a.name == "expr" {
+			return s.eval(a.value)
+		}
+	}
+
+	return false, fmt.Errorf("%w: не указан параметр expr", ErrDirective)
+}
+
+// подставить значения переменных $name и ${name}; \$ - символ доллара
+func (s *state) expand(value string) string {
+	if !strings.ContainsAny(value, `$\`) {
+		return value
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		if c == '\\' && i+1 < len(value) && value[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+
+			continue
+		}
+
+		if c != '$' || i+1 == len(value) {
+			b.WriteByte(c)
+
+			continue
+		}
+
+		var name string
+
+		if value[i+1] == '{' {
+			end := strings.IndexByte(value[i+2:], '}')
+			if end == -1 {
+				b.WriteString(value[i:])
+
+				break
+			}
+
+			name = value[i+2 : i+2+end]
+			i += end + 2
+		} else {
+			j := i + 1
+			for j < len(value) && isNameByte(value[j]) {
+				j++
+			}
+
+			if j == i+1 {
+				b.WriteByte(c)
+
+				continue
+			}
+
+			name = value[i+1 : j]
+			i = j - 1
+		}
+
+		b.WriteString(s.vars[name])
+	}
+
+	return b.String()
+}
+
+// вывести сообщение об ошибке на месте директивы и записать ошибку в лог запроса
+func (s *state) fail(f frame, err error) {
+	s.out.WriteString(errMsg)
+	s.doc.Log.Errorf("SSI %q: %v", f.file, err)
+}
+
+// разобрать директиву вида name attr="value" attr='value'
+func parseDirective(text string) (string, []attr, error) {
+	text = strings.TrimSpace(text)
+
+	i := 0
+	for i < len(text) && isNameByte(text[i]) {
+		i++
+	}
+
+	name := strings.ToLower(text[:i])
+	if name == "" {
+		return "", nil, fmt.Errorf("%w: %q", ErrDirective, text)
+	}
+
+	var attrs []attr
+
+	rest := strings.TrimSpace(text[i:])
+
+	for rest != "" {
+		key, value, ok := strings.Cut(rest, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if !ok || key == "" || strings.ContainsAny(key, " \t\r\n") {
+			return "", nil, fmt.Errorf("%w: %q", ErrDirective, text)
+		}
+
+		value = strings.TrimLeft(value, " \t\r\n")
+
+		if value != "" && (value[0] == '"' || value[0] == '\'' || value[0] == '`') {
+			end := closingQuote(value)
+			if end == -1 {
+				return "", nil, fmt.Errorf("%w: незакрытая кавычка в %q", ErrDirective, text)
+			}
+
+			attrs = append(attrs, attr{name: key, value: unescapeQuote(value[1:end], value[0])})
+			rest = strings.TrimSpace(value[end+1:])
+
+			continue
+		}
+
+		end := strings.IndexAny(value, " \t\r\n")
+		if end == -1 {
+			end = len(value)
+		}
+
+		attrs = append(attrs, attr{name: key, value: value[:end]})
+		rest = strings.TrimSpace(value[end:])
+	}
+
+	return name, attrs, nil
+}
+
+// позиция закрывающей кавычки значения, начинающегося с кавычки; -1 - кавычка не закрыта
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case value[0]:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// убрать экранирование кавычки внутри значения
+func unescapeQuote(value string, quote byte) string {
+	return strings.ReplaceAll(value, `\`+string(quote), string(quote))
+}
+
+// символ имени директивы или переменной
+func isNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// размер файла в сокращенном виде, как sizefmt="abbrev" в Apache
+func formatSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return strconv.FormatInt(size, 10)
+	}
+
+	value := float64(size) / unit
+
+	for _, suffix := range []string{"K", "M", "G"} {
+		if value < unit || suffix == "G" {
+			if value < 10 {
+				return strconv.FormatFloat(value, 'f', 1, 64) + suffix
+			}
+
+			return strconv.FormatFloat(value, 'f', 0, 64) + suffix
+		}
+
+		value /= unit
+	}
+
+	return strconv.FormatInt(size, 10)
+}
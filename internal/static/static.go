@@ -0,0 +1,524 @@
+// Package static - пакет с обработчиком, отдающим файлы и содержимое каталогов
+package static
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Kostushka/tcp_server/internal/archive"
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/connection/headerdata"
+	"github.com/Kostushka/tcp_server/internal/dir"
+	"github.com/Kostushka/tcp_server/internal/file"
+	"github.com/Kostushka/tcp_server/internal/filecache"
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/markdown"
+	"github.com/Kostushka/tcp_server/internal/ssi"
+)
+
+// Config - параметры отдачи файлов
+type Config struct {
+	// Root - каталог с файлами
+	Root string
+	// Prefix - начало пути запроса, которое заменяется каталогом Root (alias);
+	// пустая строка - путь запроса добавляется к Root целиком (root)
+	Prefix string
+	// Listing - выводить содержимое каталогов, иначе на запрос каталога отправляется 403
+	Listing bool
+	// Template - возвращает текущий шаблон страницы со списком файлов
+	Template func() *template.Template
+	// FileCache - кеш содержимого файлов, nil - кеш не используется
+	FileCache *filecache.Cache
+	// DirCache - кеш содержимого каталогов, nil - кеш не используется
+	DirCache *dir.Cache
+	// PerPage - количество файлов на странице со списком файлов каталога по умолчанию
+	PerPage int
+	// ArchiveMaxSize - максимальный суммарный размер файлов в архиве каталога, 0 - без ограничения
+	ArchiveMaxSize int64
+	// Markdown - отдавать файлы .md страницами HTML; с параметром ?raw=1 отдается исходный текст
+	Markdown bool
+	// MarkdownPages - отрисовывает файлы Markdown, nil - отрисовка недоступна
+	MarkdownPages *markdown.Renderer
+	// SSI - выполняет директивы Server-Side Includes в файлах с заданными расширениями, nil - SSI отключено
+	SSI *ssi.Processor
+	// TryFiles - пути, проверяемые по порядку, как try_files в nginx: $uri заменяется путем запроса,
+	// '/' в конце - проверяется каталог. Последний элемент - запасной путь, который отдается,
+	// если ничего не найдено, или код ответа вида "=404". Пусто - отдается путь запроса
+	TryFiles []string
+}
+
+// Static - обработчик, отдающий файлы и содержимое каталогов
+type Static struct {
+	cfg Config
+}
+
+// New - создать обработчик, отдающий файлы из cfg.Root
+func New(cfg Config) *Static {
+	return &Static{cfg: cfg}
+}
+
+// ServeHTTP - отправить клиенту запрошенный файл или содержимое каталога
+func (s *Static) ServeHTTP(w handler.ResponseWriter, r *handler.Request) {
+	// выбираем существующий файл из списка try_files
+	if len(s.cfg.TryFiles) > 0 && !s.tryFiles(w, r) {
+		return
+	}
+
+	// работаем с путем до файла, взятым из строки запроса
+	path := s.filePath(r.Path())
+
+	// файл Markdown отдается страницей, в кеше файлов лежит его исходный текст
+	md := s.renderMarkdown(r, path)
+	// страница SSI собирается заново на каждый запрос
+	inc := s.cfg.SSI.Match(path)
+
+	// если файл есть в кеше, отправляем его из памяти, не открывая
+	if s.cfg.FileCache != nil && !md && !inc {
+		if e, ok := s.cfg.FileCache.Get(path); ok {
+			r.Log().Infof("файл %q найден в кеше", path)
+
+			if err := sendCachedFile(w, e); err != nil {
+				r.Log().Errorf("%v", err)
+
+				return
+			}
+
+			r.Log().Infof("клиенту отправлено тело ответа из кеша")
+
+			return
+		}
+	}
+
+	// открываем запрашиваемый файл
+	f, fi, err := openFile(path)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		r.Log().Errorf("%v", err)
+
+		return
+	}
+
+	// закрыть файл
+	defer closeFile(f, r.Log())
+
+	r.Log().Infof("определен путь до файла: %q", path)
+
+	// если файл - каталог, выводим его содержимое
+	if fi.IsDir() {
+		if !s.cfg.Listing {
+			w.WriteHeader(consts.StatusForbidden)
+			r.Log().Errorf("вывод содержимого каталога %q запрещен", path)
+
+			return
+		}
+
+		s.workingWithCatalog(w, r, path)
+
+		return
+	}
+
+	if md {
+		s.sendMarkdown(w, r, path, f, fi)
+
+		return
+	}
+
+	if inc {
+		s.sendSSI(w, r, path, f, fi)
+
+		return
+	}
+
+	// отправить клиенту заголовки и файл
+	if err = s.sendFile(w, r, f, fi); err != nil {
+		r.Log().Errorf("%v", err)
+	}
+}
+
+// найти первый существующий путь из TryFiles и заменить им путь запроса;
+// возвращает false, если клиенту уже отправлен код ответа из последнего элемента
+func (s *Static) tryFiles(w handler.ResponseWriter, r *handler.Request) bool {
+	last := len(s.cfg.TryFiles) - 1
+
+	for _, try := range s.cfg.TryFiles[:last] {
+		urlPath := strings.ReplaceAll(try, "$uri", r.Path())
+		wantDir := strings.HasSuffix(urlPath, "/")
+		// путь из конфигурации с подставленным путем запроса не должен выйти за пределы Root
+		urlPath = pathpkg.Clean("/" + urlPath)
+
+		fi, err := os.Stat(s.filePath(urlPath))
+		if err != nil || fi.IsDir() != wantDir {
+			continue
+		}
+
+		if urlPath != r.Path() {
+			r.Log().Infof("try_files: путь запроса заменен на %q", urlPath)
+			r.SetPath(urlPath)
+		}
+
+		return true
+	}
+
+	fallback := strings.ReplaceAll(s.cfg.TryFiles[last], "$uri", r.Path())
+
+	if code, ok := strings.CutPrefix(fallback, "="); ok {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = consts.StatusNotFound
+		}
+
+		w.WriteHeader(status)
+		r.Log().Errorf("try_files: для пути %q не найден ни один файл", r.Path())
+
+		return false
+	}
+
+	r.Log().Infof("try_files: файл не найден, отдается запасной путь %q", fallback)
+	r.SetPath(pathpkg.Clean("/" + fallback))
+
+	return true
+}
+
+// отдавать ли файл страницей HTML: файл .md, отрисовка включена и исходный текст не запрошен
+func (s *Static) renderMarkdown(r *handler.Request, path string) bool {
+	if !s.cfg.Markdown || s.cfg.MarkdownPages == nil || r.Query().Get("raw") == "1" {
+		return false
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+
+	return ext == ".md" || ext == ".markdown"
+}
+
+// отправить клиенту файл Markdown страницей HTML
+func (s *Static) sendMarkdown(w handler.ResponseWriter, r *handler.Request, path string, f *os.File, fi os.FileInfo) {
+	page, cached, err := s.cfg.MarkdownPages.Render(path, r.Path(), fi, f)
+	if err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("%v", err)
+
+		return
+	}
+
+	if cached {
+		r.Log().Infof("страница Markdown %q найдена в кеше", path)
+	}
+
+	setContent(w, "text/html; charset=utf-8", int64(len(page)))
+
+	if _, err = w.Write(page); err != nil {
+		r.Log().Errorf("страница Markdown %q не отправлена: %v", path, err)
+
+		return
+	}
+
+	r.Log().Infof("клиенту отправлена страница Markdown %q", path)
+}
+
+// отправить клиенту страницу с выполненными директивами SSI
+func (s *Static) sendSSI(w handler.ResponseWriter, r *handler.Request, path string, f *os.File, fi os.FileInfo) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("файл %q не прочитан: %v", path, err)
+
+		return
+	}
+
+	page := s.cfg.SSI.Process(ssi.Document{
+		File:    path,
+		URLPath: r.Path(),
+		ModTime: fi.ModTime(),
+		Vars: map[string]string{
+			"QUERY_STRING":    r.RawQuery(),
+			"REQUEST_METHOD":  r.Method(),
+			"REMOTE_ADDR":     remoteAddr(r),
+			"SERVER_PROTOCOL": r.Protocol(),
+			"HTTP_HOST":       r.Host(),
+			"HTTP_USER_AGENT": r.Header("User-Agent"),
+			"HTTP_REFERER":    r.Header("Referer"),
+		},
+		Resolve: func(urlPath string) (string, error) {
+			return s.resolve(r, urlPath)
+		},
+		Log: r.Log(),
+	}, data)
+
+	// у расширений вроде .shtml может не быть типа в таблице MIME
+	contentType := headerdata.ContentType(fi.Name())
+	if contentType == "application/octet-stream" {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	setContent(w, contentType, int64(len(page)))
+
+	if _, err = w.Write(page); err != nil {
+		r.Log().Errorf("страница SSI %q не отправлена: %v", path, err)
+
+		return
+	}
+
+	r.Log().Infof("клиенту отправлена страница SSI %q", path)
+}
+
+// адрес клиента без порта; если IP-адрес неизвестен - адрес в том виде, в котором он попадает в лог
+func remoteAddr(r *handler.Request) string {
+	if ip := r.ClientIP(); ip != nil {
+		return ip.String()
+	}
+
+	return r.RemoteAddr()
+}
+
+// путь до файла для include virtual и include file: путь должен относиться к тому же location, что и страница,
+// и быть доступен клиенту по правилам доступа сервера
+func (s *Static) resolve(r *handler.Request, urlPath string) (string, error) {
+	if !strings.HasPrefix(urlPath, s.cfg.Prefix) {
+		return "", fmt.Errorf("путь %q вне location страницы", urlPath)
+	}
+
+	if err := r.CheckInclude(urlPath); err != nil {
+		return "", err
+	}
+
+	return s.filePath(urlPath), nil
+}
+
+// путь до файла: путь запроса без Prefix, добавленный к Root
+func (s *Static) filePath(urlPath string) string {
+	return filepath.Join(s.cfg.Root, "/"+strings.TrimPrefix(urlPath, s.cfg.Prefix))
+}
+
+// отправить клиенту заголовки и файл
+func (s *Static) sendFile(w handler.ResponseWriter, r *handler.Request, f *os.File, fi os.FileInfo) error {
+	setContent(w, headerdata.ContentType(fi.Name()), fi.Size())
+
+	// небольшой файл читаем целиком и помещаем в кеш
+	if s.cfg.FileCache.Fits(fi.Size()) {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			w.WriteHeader(consts.StatusInternalServerError)
+
+			return fmt.Errorf("файл не был отправлен клиенту: %w", err)
+		}
+
+		s.cfg.FileCache.Put(f.Name(), data, fi)
+
+		if _, err = w.Write(data); err != nil {
+			return fmt.Errorf("файл не был отправлен клиенту: %w", err)
+		}
+
+		r.Log().Infof("клиенту отправлено тело ответа")
+
+		return nil
+	}
+	// отправить файл клиенту
+	if err := file.Send(w, f, r.Log()); err != nil {
+		return fmt.Errorf("файл не был отправлен клиенту: %w", err)
+	}
+
+	return nil
+}
+
+// отправить клиенту заголовки и содержимое файла из кеша
+func sendCachedFile(w handler.ResponseWriter, e *filecache.Entry) error {
+	setContent(w, headerdata.ContentType(e.Name()), e.Size())
+
+	if _, err := w.Write(e.Data()); err != nil {
+		return fmt.Errorf("файл не был отправлен клиенту: %w", err)
+	}
+
+	return nil
+}
+
+// работаем с каталогом path
+func (s *Static) workingWithCatalog(w handler.ResponseWriter, r *handler.Request, path string) {
+	r.Log().Infof("файл %q: is a directory", path)
+
+	// запрошено скачивание каталога архивом
+	if format := r.Query().Get("download"); format != "" {
+		s.sendArchive(w, r, path, format)
+
+		return
+	}
+
+	page := s.listingPage(r)
+
+	// выводим содержимое каталога
+	var (
+		buf *bytes.Buffer
+		err error
+	)
+
+	if s.cfg.DirCache != nil {
+		buf, err = s.cfg.DirCache.ShowDir(path, r.Path(), s.cfg.Template(), page)
+	} else {
+		buf, err = dir.ShowDir(path, r.Path(), s.cfg.Template(), page)
+	}
+
+	if err != nil {
+		// содержимое каталога не готово к отправке - 500
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("содержимое каталога %q не готово к отправке: %v", path, err)
+
+		return
+	}
+	// отправляем заголовки и содержимое буфера
+	setContent(w, "text/html", int64(buf.Len()))
+
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		r.Log().Errorf("содержимое каталога %q не готово к отправке: %v", path, err)
+
+		return
+	}
+
+	r.Log().Infof("клиенту отправлен html файл с содержимым каталога %q", path)
+}
+
+// отправляем клиенту архив каталога, сформированный на лету и передаваемый частями
+func (s *Static) sendArchive(w handler.ResponseWriter, r *handler.Request, path, format string) {
+	contentType, err := archive.ContentType(format)
+	if err != nil {
+		w.WriteHeader(consts.StatusBadRequest)
+		r.Log().Errorf("%v", err)
+
+		return
+	}
+
+	// до начала передачи проверяем, что архив не превысит допустимый размер
+	allow := archiveFilter(r)
+
+	size, err := archive.Size(path, allow)
+	if err != nil {
+		w.WriteHeader(consts.StatusInternalServerError)
+		r.Log().Errorf("архив каталога %q не готов к отправке: %v", path, err)
+
+		return
+	}
+
+	maxSize := s.cfg.ArchiveMaxSize
+
+	if maxSize > 0 && size > maxSize {
+		w.WriteHeader(consts.StatusForbidden)
+		r.Log().Errorf("%v", fmt.Errorf("%w: каталог %q содержит %d байт", archive.ErrTooLarge, path, size))
+
+		return
+	}
+
+	// имя архива - имя каталога
+	name := filepath.Base(path) + "." + format
+
+	// без Content-Length тело передается частями, временные файлы не создаем
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+	if err = archive.Write(w, format, path, maxSize, allow); err != nil {
+		// заголовки уже отправлены, поэтому обрываем передачу без завершающего блока
+		r.Log().Errorf("архив каталога %q не был отправлен клиенту: %v", path, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	r.Log().Infof("клиенту отправлен архив %q каталога %q", name, path)
+}
+
+// в архив каталога попадают только файлы, которые клиент мог бы получить отдельными запросами:
+// проверка та же, что и для SSI include - location, правила доступа и аутентификации
+func archiveFilter(r *handler.Request) archive.Filter {
+	dirPath := r.Path()
+	// каталог обходится дважды: при подсчете размера и при записи архива
+	checked := make(map[string]bool)
+
+	return func(rel string) bool {
+		urlPath := pathpkg.Join(dirPath, rel)
+
+		if allowed, ok := checked[urlPath]; ok {
+			return allowed
+		}
+
+		err := r.CheckInclude(urlPath)
+		if err != nil {
+			r.Log().Infof("%q не попадет в архив: %v", urlPath, err)
+		}
+
+		checked[urlPath] = err == nil
+
+		return err == nil
+	}
+}
+
+// получаем параметры постраничного вывода каталога из параметров запроса ?page=&per_page=
+func (s *Static) listingPage(r *handler.Request) dir.Page {
+	page := dir.Page{
+		Number:  1,
+		PerPage: s.cfg.PerPage,
+	}
+
+	values := r.Query()
+
+	if n, err := strconv.Atoi(values.Get("page")); err == nil && n > 0 {
+		page.Number = n
+	}
+	// не даем клиенту запросить страницу больше допустимого размера
+	if n, err := strconv.Atoi(values.Get("per_page")); err == nil && n > 0 {
+		page.PerPage = min(n, consts.MaxPerPage)
+	}
+
+	return page
+}
+
+// задать тип и размер тела ответа
+func setContent(w handler.ResponseWriter, contentType string, size int64) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+}
+
+// получаем дескриптор открытого файла и информацию о нем
+func openFile(path string) (*os.File, os.FileInfo, error) {
+	f, err := file.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// получить информацию о файле
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, nil, err
+	}
+
+	return f, fi, nil
+}
+
+// статус ответа на ошибку открытия файла
+func errorStatus(err error) int {
+	switch {
+	// файл должен быть, иначе 404
+	case errors.Is(err, fs.ErrNotExist):
+		return consts.StatusNotFound
+	// файл должен быть доступен, иначе 403
+	case errors.Is(err, fs.ErrPermission):
+		return consts.StatusForbidden
+	// файл не был открыт - 500
+	default:
+		return consts.StatusInternalServerError
+	}
+}
+
+// закрыть файл, ошибку записать в лог запроса
+func closeFile(f *os.File, l *log.Logger) {
+	if err := f.Close(); err != nil {
+		l.Errorf("%v", err)
+	}
+}
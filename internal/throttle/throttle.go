@@ -0,0 +1,174 @@
+// Package throttle - пакет для ограничения скорости отдачи данных клиентам
+package throttle
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/ratelimit"
+)
+
+// максимальная порция данных, для которой за один раз резервируется полоса
+const maxChunk = 32 * 1024
+
+// Config - ограничения скорости в байтах в секунду; нулевое значение отключает соответствующее ограничение
+type Config struct {
+	// PerConn - скорость одного соединения
+	PerConn int64
+	// PerIP - суммарная скорость всех соединений одного адреса
+	PerIP int64
+	// Global - суммарная скорость всего сервера
+	Global int64
+	// Burst - сколько байт можно отправить сверх скорости после простоя, 0 - секунда передачи
+	Burst int64
+	// After - сколько байт в начале каждого соединения отправляется без ограничения
+	After int64
+}
+
+// корзина адреса клиента, удаляется при закрытии последнего соединения с адреса
+type ipBucket struct {
+	bucket *ratelimit.Bucket
+	conns  int
+}
+
+// Throttle - общие для соединений ограничения скорости
+type Throttle struct {
+	cfg    Config
+	global *ratelimit.Bucket
+
+	mu    sync.Mutex
+	perIP map[string]*ipBucket
+}
+
+// New - создать ограничения скорости
+func New(cfg Config) *Throttle {
+	t := &Throttle{
+		cfg:   cfg,
+		perIP: make(map[string]*ipBucket),
+	}
+
+	if cfg.Global > 0 {
+		t.global = t.newBucket(cfg.Global)
+	}
+
+	return t
+}
+
+// Writer - обернуть writer соединения с адреса ip; release нужно вызвать при закрытии соединения
+func (t *Throttle) Writer(w io.Writer, ip net.IP) (io.Writer, func()) {
+	tw := &writer{
+		w:     w,
+		after: t.cfg.After,
+		chunk: maxChunk,
+	}
+
+	if t.global != nil {
+		tw.buckets = append(tw.buckets, t.global)
+	}
+
+	if t.cfg.PerConn > 0 {
+		tw.buckets = append(tw.buckets, t.newBucket(t.cfg.PerConn))
+	}
+
+	release := func() {}
+
+	if t.cfg.PerIP > 0 && ip != nil {
+		key := ip.String()
+
+		t.mu.Lock()
+		b, ok := t.perIP[key]
+
+		if !ok {
+			b = &ipBucket{bucket: t.newBucket(t.cfg.PerIP)}
+			t.perIP[key] = b
+		}
+
+		b.conns++
+		t.mu.Unlock()
+
+		tw.buckets = append(tw.buckets, b.bucket)
+
+		var once sync.Once
+
+		release = func() {
+			once.Do(func() {
+				t.mu.Lock()
+				defer t.mu.Unlock()
+
+				if b.conns--; b.conns == 0 {
+					delete(t.perIP, key)
+				}
+			})
+		}
+	}
+
+	// порция не больше самой маленькой корзины, иначе ожидание будет рваным
+	for _, b := range tw.buckets {
+		tw.chunk = min(tw.chunk, int(b.Burst()))
+	}
+
+	tw.chunk = max(tw.chunk, 1)
+
+	return tw, release
+}
+
+func (t *Throttle) newBucket(rate int64) *ratelimit.Bucket {
+	burst := t.cfg.Burst
+	if burst <= 0 {
+		burst = rate
+	}
+
+	return ratelimit.NewBucket(float64(rate), float64(burst))
+}
+
+// writer - пишет данные порциями, ожидая, пока во всех корзинах не появится полоса
+type writer struct {
+	w       io.Writer
+	buckets []*ratelimit.Bucket
+	// сколько байт еще можно отправить без ограничения
+	after int64
+	chunk int
+}
+
+func (tw *writer) Write(p []byte) (int, error) {
+	var written int
+
+	// начало соединения отправляем без ограничения
+	if tw.after > 0 {
+		n := int(min(tw.after, int64(len(p))))
+
+		n, err := tw.w.Write(p[:n])
+		written += n
+		tw.after -= int64(n)
+
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	for len(p) > 0 {
+		n := min(tw.chunk, len(p))
+
+		var wait time.Duration
+		for _, b := range tw.buckets {
+			wait = max(wait, b.Reserve(float64(n)))
+		}
+
+		time.Sleep(wait)
+
+		n, err := tw.w.Write(p[:n])
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
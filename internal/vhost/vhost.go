@@ -0,0 +1,341 @@
+// Package vhost - пакет с виртуальными хостами, выбираемыми по заголовку Host
+package vhost
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Kostushka/tcp_server/internal/accesslog"
+	"github.com/Kostushka/tcp_server/internal/connection/consts"
+	"github.com/Kostushka/tcp_server/internal/dir"
+	"github.com/Kostushka/tcp_server/internal/errorpage"
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/location"
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/rewrite"
+	"github.com/Kostushka/tcp_server/internal/static"
+)
+
+// ErrInvalidHost - некорректные настройки виртуального хоста
+var ErrInvalidHost = errors.New("некорректные настройки виртуального хоста")
+
+// Config - настройки виртуального хоста из файла конфигурации сайта
+type Config struct {
+	// Names - имена хоста: точные, "*.example.com" или "www.example.*"
+	Names []string `json:"names"`
+	// Default - хост обслуживает запросы с неизвестным или пустым Host
+	Default bool `json:"default"`
+	// Root - корневой каталог хоста, пусто - корневой каталог сервера
+	Root string `json:"root"`
+	// Template - шаблон страницы со списком файлов, пусто - шаблон сервера
+	Template string `json:"template"`
+	// Log - файл лога запросов хоста, пусто - общий лог сервера
+	Log string `json:"log"`
+	// AccessLog - файл журнала запросов хоста, пусто - общий журнал сервера
+	AccessLog string `json:"access_log"`
+	// AccessLogFormat - формат журнала запросов хоста, пусто - формат сервера
+	AccessLogFormat string `json:"access_log_format"`
+	// PerPage - количество файлов на странице со списком файлов каталога
+	PerPage *int `json:"per_page"`
+	// ArchiveMaxSize - максимальный суммарный размер файлов в архиве каталога
+	ArchiveMaxSize *int64 `json:"archive_max_size"`
+	// Locations - location хоста, если не заданы - общие location сайта
+	Locations []location.Config `json:"locations"`
+	// Rewrites - правила перезаписи хоста, если не заданы - общие правила сайта
+	Rewrites []rewrite.Config `json:"rewrites"`
+	// ErrorPages - шаблоны страниц ошибок хоста поверх страниц сайта
+	ErrorPages errorpage.Config `json:"error_pages"`
+}
+
+// Options - общие для всех хостов параметры
+type Options struct {
+	// Static - параметры отдачи файлов сервера, на основе которых строятся параметры хостов
+	Static static.Config
+	// Locations - общие location сайта
+	Locations []location.Config
+	// Rewrites - общие правила перезаписи сайта
+	Rewrites []rewrite.Config
+	// ErrorPages - страницы ошибок сайта
+	ErrorPages *errorpage.Pages
+	// OpenFile - открывает файл для записи лога; повторное открытие того же пути
+	// должно возвращать уже открытый файл, чтобы перезагрузка конфигурации не плодила дескрипторы
+	OpenFile func(path string) (io.Writer, error)
+	// LogFormat - формат лога: text или json
+	LogFormat string
+	// AccessLogFormat - формат журнала запросов по умолчанию
+	AccessLogFormat string
+}
+
+// Host - виртуальный хост
+type Host struct {
+	name      string
+	root      string
+	handler   handler.Handler
+	router    *location.Router
+	rewrites  *rewrite.Rules
+	pages     *errorpage.Pages
+	log       *log.Logger
+	accessLog *accesslog.Logger
+}
+
+// String - имя хоста в том виде, в котором оно пишется в лог
+func (h *Host) String() string {
+	return h.name
+}
+
+// Handler - обработчик запросов хоста, не попавших ни в одну location
+func (h *Host) Handler() handler.Handler {
+	return h.handler
+}
+
+// Router - таблица location хоста
+func (h *Host) Router() *location.Router {
+	return h.router
+}
+
+// Root - корневой каталог хоста
+func (h *Host) Root() string {
+	return h.root
+}
+
+// Rewrites - правила перезаписи хоста
+func (h *Host) Rewrites() *rewrite.Rules {
+	return h.rewrites
+}
+
+// ErrorPages - страницы ошибок хоста
+func (h *Host) ErrorPages() *errorpage.Pages {
+	return h.pages
+}
+
+// Log - лог хоста, nil - общий лог сервера
+func (h *Host) Log() *log.Logger {
+	return h.log
+}
+
+// AccessLog - журнал запросов хоста, nil - общий журнал сервера
+func (h *Host) AccessLog() *accesslog.Logger {
+	return h.accessLog
+}
+
+// хост, заданный именем с '*' в начале или в конце
+type wildcard struct {
+	// часть имени без '*': ".example.com" или "www.example."
+	part string
+	host *Host
+}
+
+// Table - таблица виртуальных хостов
+type Table struct {
+	exact map[string]*Host
+	// "*.example.com", от длинных к коротким
+	leading []wildcard
+	// "www.example.*", от длинных к коротким
+	trailing []wildcard
+	def      *Host
+	// статус ответа для неизвестного хоста, если хост по умолчанию не задан
+	unknownStatus int
+}
+
+// New - создать таблицу хостов; unknownStatus - ответ на запрос к неизвестному хосту
+// при отсутствии хоста по умолчанию: 421 (по умолчанию) или 404
+func New(cfgs []Config, unknownStatus int, opts Options) (*Table, error) {
+	if unknownStatus == 0 {
+		unknownStatus = consts.StatusMisdirectedRequest
+	}
+
+	if unknownStatus != consts.StatusMisdirectedRequest && unknownStatus != consts.StatusNotFound {
+		return nil, fmt.Errorf("%w: ответ для неизвестного хоста %d, ожидается 421 или 404", ErrInvalidHost, unknownStatus)
+	}
+
+	t := &Table{
+		exact:         make(map[string]*Host),
+		unknownStatus: unknownStatus,
+	}
+
+	for i, cfg := range cfgs {
+		if len(cfg.Names) == 0 && !cfg.Default {
+			return nil, fmt.Errorf("%w: у хоста %d не указаны имена", ErrInvalidHost, i+1)
+		}
+
+		h, err := newHost(cfg, opts)
+		if err != nil {
+			return nil, fmt.Errorf("хост %q: %w", h.name, err)
+		}
+
+		if cfg.Default {
+			if t.def != nil {
+				return nil, fmt.Errorf("%w: хостов по умолчанию несколько: %q и %q", ErrInvalidHost, t.def.name, h.name)
+			}
+
+			t.def = h
+		}
+
+		for _, name := range cfg.Names {
+			if err = t.add(strings.ToLower(name), h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	byLen := func(w []wildcard) func(i, j int) bool {
+		return func(i, j int) bool { return len(w[i].part) > len(w[j].part) }
+	}
+
+	sort.SliceStable(t.leading, byLen(t.leading))
+	sort.SliceStable(t.trailing, byLen(t.trailing))
+
+	return t, nil
+}
+
+// добавить имя хоста в таблицу
+func (t *Table) add(name string, h *Host) error {
+	switch {
+	case strings.HasPrefix(name, "*."):
+		t.leading = append(t.leading, wildcard{part: name[1:], host: h})
+	case strings.HasSuffix(name, ".*"):
+		t.trailing = append(t.trailing, wildcard{part: name[:len(name)-1], host: h})
+	case strings.Contains(name, "*") || name == "":
+		return fmt.Errorf("%w: некорректное имя %q", ErrInvalidHost, name)
+	default:
+		if _, ok := t.exact[name]; ok {
+			return fmt.Errorf("%w: имя %q указано дважды", ErrInvalidHost, name)
+		}
+
+		t.exact[name] = h
+	}
+
+	return nil
+}
+
+// Match - найти хост по значению заголовка Host; если хост неизвестен и хоста по умолчанию нет,
+// возвращается nil и статус ответа клиенту.
+// Как в nginx: точное имя; иначе самое длинное имя с '*' в начале; иначе самое длинное имя с '*' в конце
+func (t *Table) Match(hostHeader string) (*Host, int) {
+	name := strings.ToLower(hostHeader)
+
+	// порт в имени хоста не учитываем
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+
+	name = strings.TrimSuffix(name, ".")
+
+	if h, ok := t.exact[name]; ok {
+		return h, 0
+	}
+
+	for _, w := range t.leading {
+		if strings.HasSuffix(name, w.part) {
+			return w.host, 0
+		}
+	}
+
+	for _, w := range t.trailing {
+		if strings.HasPrefix(name, w.part) {
+			return w.host, 0
+		}
+	}
+
+	if t.def != nil {
+		return t.def, 0
+	}
+
+	return nil, t.unknownStatus
+}
+
+// создать хост: обработчик файлов, location, логи
+func newHost(cfg Config, opts Options) (*Host, error) {
+	h := &Host{name: "default"}
+	if len(cfg.Names) > 0 {
+		h.name = cfg.Names[0]
+	}
+
+	s := opts.Static
+
+	if cfg.Root != "" {
+		s.Root = cfg.Root
+	}
+
+	if cfg.Template != "" {
+		t, err := dir.LoadTemplate(cfg.Template)
+		if err != nil {
+			return h, err
+		}
+
+		s.Template = func() *template.Template { return t }
+	}
+
+	if cfg.PerPage != nil {
+		s.PerPage = *cfg.PerPage
+	}
+
+	if cfg.ArchiveMaxSize != nil {
+		s.ArchiveMaxSize = *cfg.ArchiveMaxSize
+	}
+
+	h.handler = static.New(s)
+
+	locations := cfg.Locations
+	if locations == nil {
+		locations = opts.Locations
+	}
+
+	pages, err := errorpage.New(cfg.ErrorPages, opts.ErrorPages)
+	if err != nil {
+		return h, err
+	}
+
+	h.pages = pages
+
+	router, err := location.New(locations, s, pages)
+	if err != nil {
+		return h, err
+	}
+
+	h.router = router
+	h.root = s.Root
+
+	rewrites := cfg.Rewrites
+	if rewrites == nil {
+		rewrites = opts.Rewrites
+	}
+
+	if h.rewrites, err = rewrite.New(rewrites); err != nil {
+		return h, err
+	}
+
+	if cfg.Log != "" {
+		w, err := opts.OpenFile(cfg.Log)
+		if err != nil {
+			return h, err
+		}
+
+		if h.log, err = log.NewWriter(w, opts.LogFormat); err != nil {
+			return h, err
+		}
+	}
+
+	if cfg.AccessLog != "" {
+		w, err := opts.OpenFile(cfg.AccessLog)
+		if err != nil {
+			return h, err
+		}
+
+		format := cfg.AccessLogFormat
+		if format == "" {
+			format = opts.AccessLogFormat
+		}
+
+		if h.accessLog, err = accesslog.New(w, format); err != nil {
+			return h, err
+		}
+	}
+
+	return h, nil
+}
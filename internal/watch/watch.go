@@ -0,0 +1,11 @@
+// Package watch - пакет для отслеживания изменений в каталогах файловой системы
+package watch
+
+import "errors"
+
+// ErrNotSupported - отслеживание изменений не поддерживается на этой платформе
+var ErrNotSupported = errors.New("отслеживание изменений файловой системы не поддерживается")
+
+// Handler - функция, вызываемая при изменении содержимого отслеживаемого каталога;
+// path == "" - часть событий потеряна (переполнение очереди), измененными считаются все каталоги
+type Handler func(path string)
@@ -0,0 +1,136 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/Kostushka/tcp_server/internal/log"
+)
+
+// события, после которых содержимое каталога считается измененным
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// размер буфера для чтения событий: помещается не менее 64 событий с длинными именами
+const eventsBufSize = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+
+// Watcher - отслеживает изменения в каталогах через inotify
+type Watcher struct {
+	fd      int
+	file    *os.File
+	handler Handler
+
+	mu    sync.Mutex
+	paths map[int]string
+	wds   map[string]int
+}
+
+// New - создать наблюдателя; handler вызывается с путем до измененного каталога
+func New(handler Handler) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать inotify: %w", err)
+	}
+
+	w := &Watcher{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		handler: handler,
+		paths:   make(map[int]string),
+		wds:     make(map[string]int),
+	}
+
+	go w.readEvents()
+
+	return w, nil
+}
+
+// Add - начать отслеживать каталог
+func (w *Watcher) Add(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.wds[path]; ok {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask)
+	if err != nil {
+		return fmt.Errorf("не удалось отслеживать каталог %q: %w", path, err)
+	}
+
+	w.paths[wd] = path
+	w.wds[path] = wd
+
+	return nil
+}
+
+// Remove - перестать отслеживать каталог
+func (w *Watcher) Remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wd, ok := w.wds[path]
+	if !ok {
+		return
+	}
+
+	delete(w.wds, path)
+	delete(w.paths, wd)
+
+	// каталог мог быть уже удален, тогда ядро само снимает наблюдение
+	_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd)) //nolint:gosec
+}
+
+// Close - прекратить отслеживание изменений
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+// читаем события inotify и вызываем обработчик для измененных каталогов
+func (w *Watcher) readEvents() {
+	buf := make([]byte, eventsBufSize)
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Errorf("чтение событий inotify прекращено: %v", err)
+			}
+
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset])) //nolint:gosec
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			// очередь событий переполнилась (wd == -1): неизвестно, какие каталоги изменились
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				log.Warnf("очередь событий inotify переполнена, все каталоги считаются измененными")
+				w.handler("")
+
+				continue
+			}
+
+			w.mu.Lock()
+			path, ok := w.paths[int(event.Wd)]
+			// наблюдение снято ядром: каталог удален или перемещен
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.paths, int(event.Wd))
+				delete(w.wds, path)
+			}
+			w.mu.Unlock()
+
+			if ok {
+				w.handler(path)
+			}
+		}
+	}
+}
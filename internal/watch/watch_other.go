@@ -0,0 +1,24 @@
+//go:build !linux
+
+package watch
+
+// Watcher - заглушка для платформ без inotify
+type Watcher struct{}
+
+// New - на этой платформе отслеживание изменений не поддерживается
+func New(_ Handler) (*Watcher, error) {
+	return nil, ErrNotSupported
+}
+
+// Add - не поддерживается
+func (w *Watcher) Add(_ string) error {
+	return ErrNotSupported
+}
+
+// Remove - не поддерживается
+func (w *Watcher) Remove(_ string) {}
+
+// Close - не поддерживается
+func (w *Watcher) Close() error {
+	return nil
+}
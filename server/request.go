@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Kostushka/tcp_server/internal/handler"
+	"github.com/Kostushka/tcp_server/internal/log"
+	"github.com/Kostushka/tcp_server/internal/querydata"
+	"github.com/Kostushka/tcp_server/internal/requestid"
+)
+
+// ErrInvalidRequest - из переданных данных нельзя составить запрос
+var ErrInvalidRequest = errors.New("некорректный запрос")
+
+// Request - запрос клиента: строка запроса, заголовки, тело, данные клиента и логер запроса
+type Request struct {
+	r *handler.Request
+}
+
+// NewRequest - создать запрос, например, чтобы проверить обработчик без сетевого соединения;
+// target - цель запроса вида /path?query, body == nil - запрос без тела
+func NewRequest(method, target string, header map[string]string, body io.Reader) (*Request, error) {
+	var raw strings.Builder
+
+	if strings.ContainsAny(method+target, " \r\n") {
+		return nil, fmt.Errorf("%w: %q %q", ErrInvalidRequest, method, target)
+	}
+
+	raw.WriteString(method + " " + target + " HTTP/1.1\r\n")
+
+	for k, v := range header {
+		if strings.ContainsAny(k, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("%w: заголовок %q", ErrInvalidRequest, k)
+		}
+
+		raw.WriteString(k + ": " + v + "\r\n")
+	}
+
+	raw.WriteString("\r\n")
+
+	query, err := querydata.NewParseQueryData([]byte(raw.String()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	query.SetClient(querydata.Client{Scheme: "http", Host: header["Host"]})
+
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+
+	id := requestid.New()
+
+	return &Request{r: handler.NewRequest(query, body, log.With("request_id", id), id, "")}, nil
+}
+
+// Method - метод запроса
+func (r *Request) Method() string {
+	return r.r.Method()
+}
+
+// Path - декодированный и нормализованный путь запроса
+func (r *Request) Path() string {
+	return r.r.Path()
+}
+
+// SetPath - заменить путь запроса для следующих обработчиков (внутреннее перенаправление)
+func (r *Request) SetPath(path string) {
+	r.r.SetPath(path)
+}
+
+// RawQuery - строка параметров запроса без декодирования
+func (r *Request) RawQuery() string {
+	return r.r.RawQuery()
+}
+
+// Query - распарсенные параметры запроса
+func (r *Request) Query() url.Values {
+	return r.r.Query()
+}
+
+// RequestURI - цель запроса из строки запроса без изменений
+func (r *Request) RequestURI() string {
+	return r.r.RequestURI()
+}
+
+// Protocol - версия протокола из строки запроса
+func (r *Request) Protocol() string {
+	return r.r.Protocol()
+}
+
+// Header - значение заголовка запроса
+func (r *Request) Header(name string) string {
+	return r.r.Header(name)
+}
+
+// Headers - все заголовки запроса
+func (r *Request) Headers() map[string]string {
+	return r.r.Headers()
+}
+
+// RemoteAddr - адрес клиента с учетом доверенных прокси
+func (r *Request) RemoteAddr() string {
+	return r.r.RemoteAddr()
+}
+
+// ClientIP - IP-адрес клиента с учетом доверенных прокси, nil - адрес неизвестен
+func (r *Request) ClientIP() net.IP {
+	return r.r.ClientIP()
+}
+
+// Scheme - схема запроса клиента: http или https
+func (r *Request) Scheme() string {
+	return r.r.Scheme()
+}
+
+// Host - хост, к которому обращался клиент
+func (r *Request) Host() string {
+	return r.r.Host()
+}
+
+// Proxied - пришел ли запрос от доверенного прокси; иначе заголовки X-Forwarded-* и Forwarded
+// задал сам клиент
+func (r *Request) Proxied() bool {
+	return r.r.Proxied()
+}
+
+// RequestID - идентификатор запроса
+func (r *Request) RequestID() string {
+	return r.r.RequestID()
+}
+
+// User - пользователь, прошедший аутентификацию; пустая строка - аутентификация не требовалась
+func (r *Request) User() string {
+	return r.r.User()
+}
+
+// Body - тело запроса, ограниченное заголовком Content-Length
+func (r *Request) Body() io.Reader {
+	return r.r.Body()
+}
+
+// Log - логер запроса: строки содержат идентификатор запроса и данные клиента
+func (r *Request) Log() *slog.Logger {
+	return r.r.Log().Slog()
+}
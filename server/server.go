@@ -0,0 +1,175 @@
+// Package server - встраиваемый файловый сервер: прием соединений, обработчики запросов
+// и цепочка промежуточных обработчиков; по умолчанию отдает файлы из корневого каталога
+package server
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Kostushka/tcp_server/internal/accesslog"
+	"github.com/Kostushka/tcp_server/internal/connection"
+	"github.com/Kostushka/tcp_server/internal/dir"
+	"github.com/Kostushka/tcp_server/internal/filecache"
+	"github.com/Kostushka/tcp_server/internal/realip"
+	"github.com/Kostushka/tcp_server/internal/serve"
+	"github.com/Kostushka/tcp_server/internal/static"
+)
+
+// ErrServerClosed - сервер остановлен вызовом Shutdown
+var ErrServerClosed = serve.ErrServerClosed
+
+const (
+	// максимальный размер файла в кеше по умолчанию - 1 Мб
+	defaultFileCacheMaxEntry = 1 << 20
+	// время жизни записи в кеше файлов по умолчанию
+	defaultFileCacheTTL = 5 * time.Minute
+)
+
+// Config - параметры встраиваемого сервера
+type Config struct {
+	// Root - каталог, файлы из которого отдает обработчик по умолчанию
+	Root string
+	// Template - шаблон страницы со списком файлов каталога, nil - встроенный шаблон
+	Template *template.Template
+	// PerPage - количество файлов на странице со списком файлов, 0 - все файлы на одной странице
+	PerPage int
+	// ArchiveMaxSize - максимальный суммарный размер файлов в архиве каталога, 0 - без ограничения
+	ArchiveMaxSize int64
+	// FileCacheSize - суммарный объем кеша содержимого файлов в байтах, 0 - кеш отключен
+	FileCacheSize int64
+	// FileCacheMaxEntry - максимальный размер файла в кеше, 0 - 1 Мб
+	FileCacheMaxEntry int64
+	// FileCacheTTL - время жизни записи в кеше файлов, 0 - 5 минут
+	FileCacheTTL time.Duration
+	// DirCacheSize - количество каталогов в кеше содержимого каталогов, 0 - кеш отключен
+	DirCacheSize int
+	// TrustedProxies - подсети доверенных прокси, от которых принимаются заголовки X-Forwarded-* и Forwarded
+	TrustedProxies []*net.IPNet
+	// AccessLog - куда писать журнал запросов, nil - журнал не пишется
+	AccessLog io.Writer
+	// AccessLogFormat - формат журнала запросов: common (по умолчанию), combined или строка с %-директивами
+	AccessLogFormat string
+}
+
+// Server - файловый сервер
+type Server struct {
+	core     *serve.Server
+	settings *connection.Settings
+	static   Handler
+
+	mu      sync.Mutex
+	handler Handler
+	mw      []Middleware
+}
+
+// New - создать сервер с обработчиком по умолчанию, отдающим файлы из cfg.Root
+func New(cfg Config) (*Server, error) {
+	settings := &connection.Settings{
+		RootPath:       cfg.Root,
+		PerPage:        cfg.PerPage,
+		ArchiveMaxSize: cfg.ArchiveMaxSize,
+	}
+
+	t := cfg.Template
+	if t == nil {
+		t = defaultTemplate
+	}
+
+	settings.SetTemplate(t)
+
+	if cfg.FileCacheSize > 0 {
+		maxEntry, ttl := cfg.FileCacheMaxEntry, cfg.FileCacheTTL
+		if maxEntry == 0 {
+			maxEntry = defaultFileCacheMaxEntry
+		}
+
+		if ttl == 0 {
+			ttl = defaultFileCacheTTL
+		}
+
+		settings.FileCache = filecache.New(cfg.FileCacheSize, maxEntry, ttl)
+	}
+
+	if cfg.DirCacheSize > 0 {
+		settings.DirCache = dir.NewCache(cfg.DirCacheSize)
+	}
+
+	if len(cfg.TrustedProxies) > 0 {
+		settings.RealIP = realip.New(cfg.TrustedProxies)
+	}
+
+	if cfg.AccessLog != nil {
+		format := cfg.AccessLogFormat
+		if format == "" {
+			format = "common"
+		}
+
+		al, err := accesslog.New(cfg.AccessLog, format)
+		if err != nil {
+			return nil, err
+		}
+
+		settings.AccessLog = al
+	}
+
+	s := &Server{
+		core:     serve.New(settings),
+		settings: settings,
+		static:   fromInternal(static.New(settings.StaticConfig())),
+	}
+
+	s.handler = s.static
+	settings.Handler = toInternal(s.static)
+
+	return s, nil
+}
+
+// Static - обработчик по умолчанию, отдающий файлы и содержимое каталогов;
+// пригоден как следующий обработчик для собственного обработчика запросов
+func (s *Server) Static() Handler {
+	return s.static
+}
+
+// Handle - заменить обработчик запросов; вызывается до начала приема соединений
+func (s *Server) Handle(h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handler = h
+	s.settings.Handler = toInternal(Chain(s.handler, s.mw...))
+}
+
+// Use - добавить промежуточные обработчики в конец цепочки; вызывается до начала приема соединений
+func (s *Server) Use(mw ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mw = append(s.mw, mw...)
+	s.settings.Handler = toInternal(Chain(s.handler, s.mw...))
+}
+
+// ListenAndServe - слушать TCP-адрес addr и обрабатывать соединения
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve - принимать соединения из l, каждое обрабатывается в отдельной горутине;
+// после Shutdown возвращает ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	return s.core.Serve(l)
+}
+
+// Shutdown - перестать принимать соединения и дождаться завершения открытых;
+// если ctx завершится раньше, оставшиеся соединения закрываются принудительно
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.core.Shutdown(ctx)
+}
@@ -0,0 +1,24 @@
+package server
+
+import "html/template"
+
+// встроенный шаблон страницы со списком файлов, если в Config не задан собственный
+var defaultTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .DirName}}{{.DirName}}{{else}}/{{end}}</title>
+</head>
+<body>
+<h1>{{if .DirName}}{{.DirName}}{{else}}/{{end}}</h1>
+<ul>
+{{range .Files}}<li><a href="{{$.DirName}}/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{if gt .Pages 1}}<p>
+{{if .PrevPage}}<a href="?page={{.PrevPage}}&per_page={{.PerPage}}">&larr;</a>{{end}}
+{{.Page}} / {{.Pages}}
+{{if .NextPage}}<a href="?page={{.NextPage}}&per_page={{.PerPage}}">&rarr;</a>{{end}}
+</p>{{end}}
+</body>
+</html>
+`))